@@ -2,16 +2,25 @@ package main
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
 	"github.com/educ-educ/handlers-service/internal/handlers"
 	"github.com/educ-educ/handlers-service/internal/handlers/handlers_handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
 	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
+	"github.com/educ-educ/handlers-service/internal/pkg/migrations"
 	"github.com/educ-educ/handlers-service/internal/pkg/postgres"
 	"github.com/educ-educ/handlers-service/internal/pkg/server"
+	"github.com/educ-educ/handlers-service/internal/pkg/sqlite"
 	"github.com/go-playground/validator/v10"
+	"io/fs"
 	"log"
 	"os"
 	"path"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/educ-educ/handlers-service/docs"
 	"github.com/gin-gonic/gin"
@@ -49,15 +58,87 @@ func main() {
 	dbContext, cancelContext := context.WithCancel(context.Background())
 	defer cancelContext()
 
-	postgresDB, cancelDB, err := postgres.NewPostgresDb(os.Getenv("DATABASE_URL"))
-	if err != nil {
-		logger.Fatal("cannot open postgres connection")
+	var handlersRepository handlers.Repository
+	// notificationsURL is set for the Postgres backend, which is shared by replicas and notifies them of changes
+	var notificationsURL string
+	// postgresDB is set for the Postgres backend, it can also keep the rate limits shared by replicas
+	var postgresDB *sql.DB
+	switch registryBackend := os.Getenv("REGISTRY_BACKEND"); registryBackend {
+	case "", "database", "postgres":
+		databaseURL := os.Getenv("DATABASE_URL")
+		var (
+			db      *sql.DB
+			closeDB func(db *sql.DB)
+			dialect migrations.Dialect
+			schema  fs.FS
+			newRepo func(logger common.Logger, ctx context.Context, db *sql.DB) handlers.Repository
+			dbErr   error
+		)
+		if strings.HasPrefix(databaseURL, sqlite.Scheme) {
+			db, closeDB, dbErr = sqlite.NewSQLiteDb(databaseURL)
+			dialect, schema = migrations.SQLite, handlers.SQLiteMigrations()
+			newRepo = func(logger common.Logger, ctx context.Context, db *sql.DB) handlers.Repository {
+				return handlers.NewSQLiteHandlersRepository(logger, ctx, db)
+			}
+		} else {
+			db, closeDB, dbErr = postgres.NewPostgresDb(databaseURL)
+			notificationsURL = databaseURL
+			postgresDB = db
+			dialect, schema = migrations.Postgres, handlers.PostgresMigrations()
+			newRepo = func(logger common.Logger, ctx context.Context, db *sql.DB) handlers.Repository {
+				return handlers.NewPostgresHandlersRepository(logger, ctx, db)
+			}
+		}
+		if dbErr != nil {
+			logger.Fatal("cannot open database connection: ", dbErr)
+		}
+		defer closeDB(db)
+
+		migrator, err := migrations.NewMigrator(logger, db, dialect, schema)
+		if err != nil {
+			logger.Fatal(err)
+		}
+
+		if len(os.Args) > 1 && os.Args[1] == "migrate" {
+			runMigrateCommand(logger, dbContext, migrator, os.Args[2:])
+			return
+		}
+
+		if os.Getenv("MIGRATE_ON_START") != "false" {
+			if err = migrator.Up(dbContext); err != nil {
+				logger.Fatal("cannot apply migrations: ", err)
+			}
+		}
+
+		handlersRepository = newRepo(logger, dbContext, db)
+	case "memory":
+		handlersRepository = handlers.NewMemoryHandlersRepository()
+	default:
+		logger.Fatal("invalid REGISTRY_BACKEND: ", registryBackend)
+	}
+
+	// the cache is shared by every consumer of the repository, so their changes invalidate it
+	cachingRepository := handlers.NewCachingHandlersRepository(logger, handlersRepository,
+		durationFromEnv(logger, "SPEC_CACHE_TTL", 5*time.Minute))
+	if notificationsURL != "" {
+		if err = cachingRepository.ListenForChanges(dbContext, notificationsURL); err != nil {
+			logger.Fatal("cannot listen for handler changes: ", err)
+		}
 	}
-	defer cancelDB(postgresDB)
+	handlersRepository = cachingRepository
 
 	validate := validator.New()
 
 	router := gin.New()
+	// X-Forwarded-For is honoured only for requests coming through the trusted proxies, per-caller rate limits
+	// of anonymous callers rely on their IPs
+	var trustedProxies []string
+	if proxies := os.Getenv("TRUSTED_PROXIES"); proxies != "" {
+		trustedProxies = strings.Split(proxies, ",")
+	}
+	if err = router.SetTrustedProxies(trustedProxies); err != nil {
+		logger.Fatal("invalid TRUSTED_PROXIES: ", err)
+	}
 	router.Use(gin.Recovery())
 	router.Use(http_tools.ErrorsMiddleware(logger, 5*Mb))
 
@@ -76,30 +157,261 @@ func main() {
 		logger.Fatal(err)
 	}
 
+	upstreamTimeouts := handlers.Timeouts{
+		ConnectMs:   millisecondsFromEnv(logger, "UPSTREAM_CONNECT_TIMEOUT", handlers.DefaultTimeouts.ConnectMs),
+		FirstByteMs: millisecondsFromEnv(logger, "UPSTREAM_FIRST_BYTE_TIMEOUT", handlers.DefaultTimeouts.FirstByteMs),
+		TotalMs:     millisecondsFromEnv(logger, "UPSTREAM_TOTAL_TIMEOUT", handlers.DefaultTimeouts.TotalMs),
+	}
+	maxUpstreamTimeout := durationFromEnv(logger, "UPSTREAM_MAX_TIMEOUT", handlers.DefaultMaxTimeout)
+	if time.Duration(upstreamTimeouts.TotalMs)*time.Millisecond > maxUpstreamTimeout {
+		logger.Fatal("UPSTREAM_TOTAL_TIMEOUT exceeds UPSTREAM_MAX_TIMEOUT")
+	}
+
 	handlersRouter := router.Group("/handlers")
 	{
 		handlersValidator := handlers.NewValidator(logger)
-		handlersRepository := handlers.NewPostgresHandlersRepository(logger, dbContext, postgresDB)
+		handlersValidator.SetDefaultTimeouts(upstreamTimeouts)
+		balancer := handlers.NewBalancer()
+
+		healthChecker := handlers.NewHealthChecker(logger, handlersRepository, balancer, handlers.HealthCheckConfig{
+			Interval:           durationFromEnv(logger, "HEALTH_CHECK_INTERVAL", 10*time.Second),
+			Timeout:            durationFromEnv(logger, "HEALTH_CHECK_TIMEOUT", 2*time.Second),
+			HealthyThreshold:   intFromEnv(logger, "HEALTH_CHECK_HEALTHY_THRESHOLD", 2),
+			UnhealthyThreshold: intFromEnv(logger, "HEALTH_CHECK_UNHEALTHY_THRESHOLD", 3),
+			HistorySize:        intFromEnv(logger, "HEALTH_CHECK_HISTORY_SIZE", 20),
+		})
+		healthChecker.Start(dbContext)
+
+		leaseExpiryAction := os.Getenv("LEASE_EXPIRY_ACTION")
+		if leaseExpiryAction == "" {
+			leaseExpiryAction = handlers.UnregisterExpired
+		}
+		if leaseExpiryAction != handlers.UnregisterExpired && leaseExpiryAction != handlers.DeactivateExpired {
+			logger.Fatal("invalid LEASE_EXPIRY_ACTION: ", leaseExpiryAction)
+		}
+		leaseReaper := handlers.NewLeaseReaper(logger, handlersRepository,
+			durationFromEnv(logger, "LEASE_REAP_INTERVAL", 5*time.Second), leaseExpiryAction)
+		leaseReaper.Start(dbContext)
+
+		service := handlers.NewService(logger, handlersRepository, handlersValidator, balancer)
+		if adminKeys := os.Getenv("ADMIN_KEYS"); adminKeys != "" {
+			service.SetAdminKeys(strings.Split(adminKeys, ","))
+		}
+		service.SetClaimsSigningKey([]byte(os.Getenv("CLAIMS_SIGNING_KEY")))
+		service.SetAccessClaims(handlers.AccessClaims{
+			Roles:  os.Getenv("JWT_ROLES_CLAIM"),
+			Scopes: os.Getenv("JWT_SCOPES_CLAIM"),
+		})
+		service.SetDefaultTimeouts(upstreamTimeouts, maxUpstreamTimeout)
+		service.SetMaxValidatedBody(int64(intFromEnv(logger, "RESPONSE_VALIDATION_MAX_BODY",
+			int(handlers.DefaultMaxValidatedBody))))
+		service.SetSchemaCacheSize(intFromEnv(logger, "SCHEMA_CACHE_SIZE", handlers.DefaultSchemaCacheSize))
+		service.SetBreakerConfig(handlers.BreakerConfig{
+			Window:        intFromEnv(logger, "BREAKER_WINDOW", handlers.DefaultBreakerConfig.Window),
+			MinCalls:      intFromEnv(logger, "BREAKER_MIN_CALLS", handlers.DefaultBreakerConfig.MinCalls),
+			FailureRate:   rateFromEnv(logger, "BREAKER_FAILURE_RATE", handlers.DefaultBreakerConfig.FailureRate),
+			SlowCall:      durationFromEnv(logger, "BREAKER_SLOW_CALL", handlers.DefaultBreakerConfig.SlowCall),
+			SlowCallRate:  rateFromEnv(logger, "BREAKER_SLOW_CALL_RATE", handlers.DefaultBreakerConfig.SlowCallRate),
+			EjectAfter:    intFromEnv(logger, "BREAKER_EJECT_AFTER", handlers.DefaultBreakerConfig.EjectAfter),
+			OpenFor:       durationFromEnv(logger, "BREAKER_OPEN_FOR", handlers.DefaultBreakerConfig.OpenFor),
+			HalfOpenCalls: intFromEnv(logger, "BREAKER_HALF_OPEN_CALLS", handlers.DefaultBreakerConfig.HalfOpenCalls),
+			MaxEjection:   durationFromEnv(logger, "BREAKER_MAX_EJECTION", handlers.DefaultBreakerConfig.MaxEjection),
+		})
+		switch rateLimitStore := os.Getenv("RATE_LIMIT_STORE"); rateLimitStore {
+		case "", "local":
+		case "postgres":
+			if postgresDB == nil {
+				logger.Fatal("RATE_LIMIT_STORE postgres requires the Postgres registry backend")
+			}
+			rateLimiter := handlers.NewPostgresRateLimiter(logger, dbContext, postgresDB)
+			rateLimiter.Start(dbContext)
+			service.SetRateLimiter(rateLimiter)
+		default:
+			logger.Fatal("invalid RATE_LIMIT_STORE: ", rateLimitStore)
+		}
 
-		service := handlers.NewService(logger, handlersRepository, handlersValidator)
+		if seedFile := os.Getenv("REGISTRY_SEED_FILE"); seedFile != "" {
+			specifications, err := handlers.LoadSeedFile(seedFile)
+			if err != nil {
+				logger.Fatal("cannot load seed file: ", err)
+			}
+			for _, specification := range specifications {
+				if err = validate.Struct(specification); err != nil {
+					logger.Fatal("invalid specification in seed file: ", err)
+				}
+			}
+			if httpErr := service.Seed(specifications); httpErr != nil {
+				logger.Fatal("cannot seed registry: ", httpErr)
+			}
+		}
+
+		openAPIAggregator := handlers.NewOpenAPIAggregator(logger, handlersRepository)
+		service.AddObserver(openAPIAggregator)
+		leaseReaper.AddObserver(openAPIAggregator)
+		cachingRepository.AddObserver(openAPIAggregator)
 
-		getSpecHandler := handlers_handlers.NewGetSpecHandler(logger, service, validate)
+		getSpecHandler := handlers_handlers.NewGetSpecHandler(logger, service, healthChecker, validate)
+		listHandler := handlers_handlers.NewListHandler(logger, service, validate)
 		registerHandler := handlers_handlers.NewRegisterHandler(logger, service, validate)
+		registerOpenAPIHandler := handlers_handlers.NewRegisterOpenAPIHandler(logger, service, validate)
 		unregisterHandler := handlers_handlers.NewUnregisterHandler(logger, service, validate)
 		updateHandler := handlers_handlers.NewUpdateHandler(logger, service, validate)
+		upsertHandler := handlers_handlers.NewUpsertHandler(logger, service, validate)
+		transitionHandler := handlers_handlers.NewTransitionHandler(logger, service, validate)
 		useHandler := handlers_handlers.NewUseHandler(logger, service, validate, 5*Mb)
+		listRevisionsHandler := handlers_handlers.NewListRevisionsHandler(logger, service, validate)
+		getRevisionHandler := handlers_handlers.NewGetRevisionHandler(logger, service, validate)
+		rollbackHandler := handlers_handlers.NewRollbackHandler(logger, service, validate)
+		addInstanceHandler := handlers_handlers.NewAddInstanceHandler(logger, service, validate)
+		removeInstanceHandler := handlers_handlers.NewRemoveInstanceHandler(logger, service, validate)
+		heartbeatHandler := handlers_handlers.NewHeartbeatHandler(logger, service, validate)
+		rotateOwnerKeyHandler := handlers_handlers.NewRotateOwnerKeyHandler(logger, service, validate)
+		transferOwnershipHandler := handlers_handlers.NewTransferOwnershipHandler(logger, service, validate)
+		contractViolationsHandler := handlers_handlers.NewContractViolationsHandler(logger, service, validate)
+		circuitBreakersHandler := handlers_handlers.NewCircuitBreakersHandler(logger, service, validate)
+		cacheStatsHandler := handlers_handlers.NewCacheStatsHandler(logger, service, cachingRepository)
+		aggregatedDocsHandler := handlers_handlers.NewAggregatedDocsHandler(logger, openAPIAggregator)
+		handlerDocsHandler := handlers_handlers.NewHandlerDocsHandler(logger, service, openAPIAggregator)
+
+		// callers of handlers are authenticated only when a token verification key is configured,
+		// get-spec accepts anonymous callers anyway, it needs the token only to hide methods
+		anonymous := func(c *gin.Context) { c.Next() }
+		authenticate, identify := gin.HandlerFunc(anonymous), gin.HandlerFunc(anonymous)
+		if verifier := newTokenVerifier(logger); verifier != nil {
+			authenticate = jwt.Middleware(logger, verifier)
+			identify = jwt.OptionalMiddleware(logger, verifier)
+		}
 
-		handlersRouter.GET("/get-spec", getSpecHandler.Handle)
+		handlersRouter.GET("/get-spec", identify, getSpecHandler.Handle)
+		handlersRouter.GET("/list", listHandler.Handle)
 		handlersRouter.POST("/register", registerHandler.Handle)
+		handlersRouter.POST("/register-openapi", registerOpenAPIHandler.Handle)
 		handlersRouter.DELETE("/unregister", unregisterHandler.Handle)
 		handlersRouter.PUT("/update", updateHandler.Handle)
-		handlersRouter.POST("/use", useHandler.Handle)
+		handlersRouter.PUT("/upsert", upsertHandler.Handle)
+		handlersRouter.POST("/transition", transitionHandler.Handle)
+		handlersRouter.POST("/use", authenticate, useHandler.Handle)
+		handlersRouter.GET("/revisions", listRevisionsHandler.Handle)
+		handlersRouter.GET("/revision", getRevisionHandler.Handle)
+		handlersRouter.POST("/rollback", rollbackHandler.Handle)
+		handlersRouter.POST("/instances/add", addInstanceHandler.Handle)
+		handlersRouter.DELETE("/instances/remove", removeInstanceHandler.Handle)
+		handlersRouter.POST("/heartbeat", heartbeatHandler.Handle)
+		handlersRouter.POST("/owner/rotate-key", rotateOwnerKeyHandler.Handle)
+		handlersRouter.POST("/owner/transfer", transferOwnershipHandler.Handle)
+		handlersRouter.GET("/contract-violations", contractViolationsHandler.Handle)
+		handlersRouter.GET("/circuit-breakers", circuitBreakersHandler.Handle)
+		handlersRouter.GET("/cache-stats", cacheStatsHandler.Handle)
+
+		router.GET("/swagger-handlers/doc.json", aggregatedDocsHandler.Handle)
+		router.GET("/swagger-handlers/:handler/doc.json", handlerDocsHandler.Handle)
+		router.GET("/swagger-handlers/ui/*any", ginSwagger.WrapHandler(swaggerFiles.Handler,
+			ginSwagger.URL("/swagger-handlers/doc.json")))
 	}
 
 	addr := ":" + os.Getenv("SERVICE_PORT")
-	serv := server.NewServer(logger, router, addr)
+	serv := server.NewServer(logger, router, addr, maxUpstreamTimeout)
 	err = serv.Start()
 	if err != nil {
 		logger.Fatal(err)
 	}
 }
+
+// runMigrateCommand handles "migrate up", "migrate down [steps]" and "migrate version", down reverts one migration
+// unless the number of steps is given
+func runMigrateCommand(logger common.Logger, ctx context.Context, migrator *migrations.Migrator, args []string) {
+	if len(args) == 0 {
+		logger.Fatal("usage: migrate up | down [steps] | version")
+	}
+
+	switch args[0] {
+	case "up":
+		if err := migrator.Up(ctx); err != nil {
+			logger.Fatal(err)
+		}
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			var err error
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps <= 0 {
+				logger.Fatal("invalid number of steps: ", args[1])
+			}
+		}
+		if err := migrator.Down(ctx, steps); err != nil {
+			logger.Fatal(err)
+		}
+	case "version":
+	default:
+		logger.Fatal("unknown migrate command: ", args[0])
+	}
+
+	version, err := migrator.Version(ctx)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	logger.Info("schema version is ", version)
+}
+
+func durationFromEnv(logger common.Logger, key string, defaultValue time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	duration, err := time.ParseDuration(value)
+	if err != nil || duration <= 0 {
+		logger.Fatal("invalid duration in ", key, ": ", value)
+	}
+	return duration
+}
+
+// millisecondsFromEnv reads a duration like durationFromEnv, for settings kept in whole milliseconds
+func millisecondsFromEnv(logger common.Logger, key string, defaultValue int) int {
+	return int(durationFromEnv(logger, key, time.Duration(defaultValue)*time.Millisecond).Milliseconds())
+}
+
+func intFromEnv(logger common.Logger, key string, defaultValue int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	number, err := strconv.Atoi(value)
+	if err != nil || number <= 0 {
+		logger.Fatal("invalid number in ", key, ": ", value)
+	}
+	return number
+}
+
+// rateFromEnv reads a share of calls, which must be above 0 and at most 1
+func rateFromEnv(logger common.Logger, key string, defaultValue float64) float64 {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+
+	rate, err := strconv.ParseFloat(value, 64)
+	if err != nil || rate <= 0 || rate > 1 {
+		logger.Fatal("invalid rate in ", key, ": ", value)
+	}
+	return rate
+}
+
+// newTokenVerifier returns nil when neither JWT_HS256_SECRET nor JWT_JWKS is set
+func newTokenVerifier(logger common.Logger) *jwt.Verifier {
+	config := jwt.Config{
+		HS256Secret: []byte(os.Getenv("JWT_HS256_SECRET")),
+		JWKS:        os.Getenv("JWT_JWKS"),
+		Issuer:      os.Getenv("JWT_ISSUER"),
+		Audience:    os.Getenv("JWT_AUDIENCE"),
+	}
+	if len(config.HS256Secret) == 0 && config.JWKS == "" {
+		return nil
+	}
+
+	verifier, err := jwt.NewVerifier(config)
+	if err != nil {
+		logger.Fatal("cannot create token verifier: ", err)
+	}
+	return verifier
+}
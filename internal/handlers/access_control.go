@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
+	"strings"
+)
+
+// AccessClaims names the claims holding the roles and scopes of the caller. A claim is either a list of strings
+// or a space-separated string, a dotted name like realm_access.roles points into nested objects.
+type AccessClaims struct {
+	Roles  string
+	Scopes string
+}
+
+var defaultAccessClaims = AccessClaims{Roles: "roles", Scopes: "scope"}
+
+// SetAccessClaims overrides the default "roles" and "scope" claims, empty names keep the defaults
+func (service *Service) SetAccessClaims(claims AccessClaims) {
+	if claims.Roles != "" {
+		service.accessClaims.Roles = claims.Roles
+	}
+	if claims.Scopes != "" {
+		service.accessClaims.Scopes = claims.Scopes
+	}
+}
+
+func (access *MethodAccess) restricted() bool {
+	return access != nil && (len(access.Roles) > 0 || len(access.Scopes) > 0)
+}
+
+// normalizeMethodAccess drops empty access requirements, so they are stored and compared like absent ones
+func normalizeMethodAccess(methods []Method) []Method {
+	normalized := make([]Method, len(methods))
+	for i, method := range methods {
+		if !method.Access.restricted() {
+			method.Access = nil
+		}
+		normalized[i] = method
+	}
+	return normalized
+}
+
+// checkAccess makes sure the caller may call the method and logs the decision for restricted methods
+func (service *Service) checkAccess(handlerID string, method Method, claims jwt.Claims) *http_tools.Error {
+	if !method.Access.restricted() {
+		return nil
+	}
+
+	reason := service.denyReason(method.Access, claims)
+	decision := fmt.Sprint("handler ", handlerID, " method ", method.MethodType, " ", method.PathPart,
+		" caller ", callerSubject(claims))
+	if reason == "" {
+		service.logger.Info("access granted: ", decision)
+		return nil
+	}
+	service.logger.Warn("access denied: ", decision, ": ", reason)
+
+	if claims == nil {
+		return &http_tools.Error{Type: http_tools.UnauthorizedError, Info: reason}
+	}
+	return &http_tools.Error{Type: http_tools.AccessDeniedError, Info: reason}
+}
+
+// VisibleMethods keeps the methods of the specification the caller may call
+func (service *Service) VisibleMethods(specification Specification, claims jwt.Claims) Specification {
+	methods := make([]Method, 0, len(specification.Methods))
+	for _, method := range specification.Methods {
+		if !method.Access.restricted() || service.denyReason(method.Access, claims) == "" {
+			methods = append(methods, method)
+		}
+	}
+	specification.Methods = methods
+	return specification
+}
+
+// denyReason returns why the caller can't call a method with the access requirements, or an empty string
+// if it can
+func (service *Service) denyReason(access *MethodAccess, claims jwt.Claims) string {
+	if claims == nil {
+		return "method requires a bearer token"
+	}
+
+	if len(access.Roles) > 0 {
+		roles := claimValues(claims, service.accessClaims.Roles)
+		granted := false
+		for _, role := range access.Roles {
+			if contains(roles, role) {
+				granted = true
+				break
+			}
+		}
+		if !granted {
+			return "method requires one of the roles " + strings.Join(access.Roles, ", ")
+		}
+	}
+
+	scopes := claimValues(claims, service.accessClaims.Scopes)
+	for _, scope := range access.Scopes {
+		if !contains(scopes, scope) {
+			return "method requires the scope " + scope
+		}
+	}
+
+	return ""
+}
+
+// claimValues reads a list of strings or a space-separated string from the claim, anything else counts as empty
+func claimValues(claims jwt.Claims, name string) []string {
+	value, ok := claims[name]
+	if !ok {
+		var current any = map[string]any(claims)
+		for _, part := range strings.Split(name, ".") {
+			object, isObject := current.(map[string]any)
+			if !isObject {
+				return nil
+			}
+			current = object[part]
+		}
+		value = current
+	}
+
+	switch typed := value.(type) {
+	case string:
+		return strings.Fields(typed)
+	case []any:
+		values := make([]string, 0, len(typed))
+		for _, item := range typed {
+			if text, isText := item.(string); isText {
+				values = append(values, text)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+func callerSubject(claims jwt.Claims) string {
+	if claims == nil {
+		return "anonymous"
+	}
+	if subject, ok := claims["sub"].(string); ok && subject != "" {
+		return subject
+	}
+	return "unknown"
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"math/rand"
+	"sync"
+	"time"
+)
+
+var errNoHealthyInstances = errors.New("handler has no healthy instances")
+
+type instanceState struct {
+	inFlight      int
+	currentWeight int
+	// unhealthy is reported by the background health checks, instances failing calls are ejected by
+	// the circuit breakers
+	unhealthy bool
+}
+
+// Balancer picks an instance of a handler for every proxied call and keeps track of calls in flight.
+// State is kept per socket, sockets are unique across handlers.
+type Balancer struct {
+	mu        sync.Mutex
+	instances map[string]*instanceState
+	random    *rand.Rand
+}
+
+func NewBalancer() *Balancer {
+	return &Balancer{
+		instances: make(map[string]*instanceState),
+		random:    rand.New(rand.NewSource(time.Now().UnixNano())),
+	}
+}
+
+// Pick chooses one of the healthy instances with the given strategy. The returned release function must be
+// called once the call is finished.
+func (balancer *Balancer) Pick(strategy string, instances []Instance) (Instance, func(), error) {
+	balancer.mu.Lock()
+	defer balancer.mu.Unlock()
+
+	candidates := make([]Instance, 0, len(instances))
+	for _, instance := range instances {
+		if balancer.state(instance.Socket).unhealthy {
+			continue
+		}
+		candidates = append(candidates, instance)
+	}
+	if len(candidates) == 0 {
+		return Instance{}, nil, errNoHealthyInstances
+	}
+
+	var picked Instance
+	switch strategy {
+	case LeastInFlight:
+		picked = balancer.pickLeastInFlight(candidates)
+	case WeightedRandom:
+		picked = balancer.pickWeightedRandom(candidates)
+	default:
+		picked = balancer.pickRoundRobin(candidates)
+	}
+
+	state := balancer.state(picked.Socket)
+	state.inFlight++
+
+	var once sync.Once
+	release := func() {
+		once.Do(func() {
+			balancer.mu.Lock()
+			defer balancer.mu.Unlock()
+
+			state.inFlight--
+		})
+	}
+
+	return picked, release, nil
+}
+
+// InFlight counts the calls proxied by this replica to the instances which are not finished yet
+func (balancer *Balancer) InFlight(instances []Instance) int {
+	balancer.mu.Lock()
+	defer balancer.mu.Unlock()
+
+	inFlight := 0
+	for _, instance := range instances {
+		if state, ok := balancer.instances[instance.Socket]; ok {
+			inFlight += state.inFlight
+		}
+	}
+
+	return inFlight
+}
+
+// SetHealthy records the result of the active health checks of the instance
+func (balancer *Balancer) SetHealthy(socket string, healthy bool) {
+	balancer.mu.Lock()
+	defer balancer.mu.Unlock()
+
+	balancer.state(socket).unhealthy = !healthy
+}
+
+// pickRoundRobin is the smooth weighted round robin, instances with equal weights are taken in turn
+func (balancer *Balancer) pickRoundRobin(candidates []Instance) Instance {
+	total := 0
+	var best *instanceState
+	picked := candidates[0]
+	for _, instance := range candidates {
+		state := balancer.state(instance.Socket)
+		state.currentWeight += instance.Weight
+		total += instance.Weight
+		if best == nil || state.currentWeight > best.currentWeight {
+			best = state
+			picked = instance
+		}
+	}
+	best.currentWeight -= total
+
+	return picked
+}
+
+func (balancer *Balancer) pickLeastInFlight(candidates []Instance) Instance {
+	picked := candidates[0]
+	for _, instance := range candidates[1:] {
+		// compares inFlight/weight ratios without division
+		if balancer.state(instance.Socket).inFlight*picked.Weight < balancer.state(picked.Socket).inFlight*instance.Weight {
+			picked = instance
+		}
+	}
+
+	return picked
+}
+
+func (balancer *Balancer) pickWeightedRandom(candidates []Instance) Instance {
+	total := 0
+	for _, instance := range candidates {
+		total += instance.Weight
+	}
+
+	point := balancer.random.Intn(total)
+	for _, instance := range candidates {
+		if point < instance.Weight {
+			return instance
+		}
+		point -= instance.Weight
+	}
+
+	return candidates[len(candidates)-1]
+}
+
+func (balancer *Balancer) state(socket string) *instanceState {
+	state, ok := balancer.instances[socket]
+	if !ok {
+		state = &instanceState{}
+		balancer.instances[socket] = state
+	}
+	return state
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"context"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/lib/pq"
+	"sync"
+	"time"
+)
+
+// HandlerChangedChannel is the Postgres notification channel the triggers send IDs of changed handlers to
+const HandlerChangedChannel = "handler_changed"
+
+// CacheStats describes the cache since the start of the replica
+type CacheStats struct {
+	Hits          int64   `json:"hits"`
+	Misses        int64   `json:"misses"`
+	HitRatio      float64 `json:"hit_ratio"`
+	Invalidations int64   `json:"invalidations"`
+	Entries       int     `json:"entries"`
+	// Listening is false while the change notifications are unavailable, the cache is bypassed meanwhile
+	Listening bool `json:"listening"`
+}
+
+type cacheEntry[V any] struct {
+	value     V
+	expiresAt time.Time
+}
+
+// CachingHandlersRepository keeps specifications, statuses and names of handlers in memory, so routing a request
+// usually doesn't touch the database. Changes made through the repository invalidate the cache right away,
+// changes made by other replicas arrive through ListenForChanges. Entries also expire after the TTL.
+type CachingHandlersRepository struct {
+	Repository
+	logger common.Logger
+	ttl    time.Duration
+
+	mu       sync.Mutex
+	specs    map[string]cacheEntry[Specification]
+	statuses map[string]cacheEntry[HandlerStatus]
+	names    map[string]cacheEntry[string]
+	// generation grows with every invalidation, loads which raced with one are not stored
+	generation      int64
+	requireListener bool
+	listening       bool
+	stats           CacheStats
+	// observers learn about the changes made by other replicas
+	observers registryObservers
+}
+
+func NewCachingHandlersRepository(logger common.Logger, repo Repository, ttl time.Duration) *CachingHandlersRepository {
+	return &CachingHandlersRepository{
+		Repository: repo,
+		logger:     logger,
+		ttl:        ttl,
+		specs:      make(map[string]cacheEntry[Specification]),
+		statuses:   make(map[string]cacheEntry[HandlerStatus]),
+		names:      make(map[string]cacheEntry[string]),
+	}
+}
+
+// ListenForChanges subscribes to the notifications sent by the Postgres triggers on every change of a handler.
+// The cache is bypassed whenever the listener is disconnected, since notifications sent meanwhile are lost.
+func (cache *CachingHandlersRepository) ListenForChanges(ctx context.Context, connURL string) error {
+	cache.mu.Lock()
+	cache.requireListener = true
+	cache.mu.Unlock()
+
+	listener := pq.NewListener(connURL, time.Second, time.Minute, cache.onListenerEvent)
+	if err := listener.Listen(HandlerChangedChannel); err != nil {
+		_ = listener.Close()
+		return err
+	}
+	cache.setListening(true)
+
+	go func() {
+		defer func() {
+			if err := listener.Close(); err != nil {
+				cache.logger.Error(err)
+			}
+		}()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case notification := <-listener.NotificationChannel():
+				// a nil notification follows a reconnect, anything could have changed before it
+				if notification == nil {
+					cache.Purge()
+					cache.notifyObservers("")
+					continue
+				}
+				cache.Invalidate(notification.Extra)
+				cache.notifyObservers(notification.Extra)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// AddObserver subscribes the observer to the changes made by other replicas, an empty handler ID means that
+// any handler could have changed
+func (cache *CachingHandlersRepository) AddObserver(observer RegistryObserver) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.observers = append(cache.observers, observer)
+}
+
+// notifyObservers is called without the lock held, so observers may use the repository
+func (cache *CachingHandlersRepository) notifyObservers(handlerID string) {
+	cache.mu.Lock()
+	observers := cache.observers
+	cache.mu.Unlock()
+
+	observers.notify(handlerID)
+}
+
+func (cache *CachingHandlersRepository) onListenerEvent(event pq.ListenerEventType, err error) {
+	switch event {
+	case pq.ListenerEventDisconnected:
+		cache.logger.Warn("handler changes listener disconnected, cache is bypassed: ", err)
+		cache.setListening(false)
+	case pq.ListenerEventReconnected:
+		cache.logger.Info("handler changes listener reconnected")
+		cache.setListening(true)
+	}
+}
+
+func (cache *CachingHandlersRepository) setListening(listening bool) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.listening = listening
+	cache.purgeLocked()
+}
+
+// Invalidate drops everything cached about the handler
+func (cache *CachingHandlersRepository) Invalidate(handlerID string) {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	delete(cache.specs, handlerID)
+	delete(cache.statuses, handlerID)
+	for name, entry := range cache.names {
+		if entry.value == handlerID {
+			delete(cache.names, name)
+		}
+	}
+	cache.generation++
+	cache.stats.Invalidations++
+}
+
+// Purge drops the whole cache
+func (cache *CachingHandlersRepository) Purge() {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	cache.purgeLocked()
+}
+
+func (cache *CachingHandlersRepository) purgeLocked() {
+	cache.specs = make(map[string]cacheEntry[Specification])
+	cache.statuses = make(map[string]cacheEntry[HandlerStatus])
+	cache.names = make(map[string]cacheEntry[string])
+	cache.generation++
+	cache.stats.Invalidations++
+}
+
+func (cache *CachingHandlersRepository) Stats() CacheStats {
+	cache.mu.Lock()
+	defer cache.mu.Unlock()
+
+	stats := cache.stats
+	if stats.Hits+stats.Misses > 0 {
+		stats.HitRatio = float64(stats.Hits) / float64(stats.Hits+stats.Misses)
+	}
+	stats.Entries = len(cache.specs) + len(cache.statuses) + len(cache.names)
+	stats.Listening = cache.listening || !cache.requireListener
+
+	return stats
+}
+
+// cachedLoad returns the entry stored under the key or loads and stores it, errors are never cached
+func cachedLoad[V any](cache *CachingHandlersRepository, entries func() map[string]cacheEntry[V], key string,
+	load func() (V, *http_tools.Error)) (V, *http_tools.Error) {
+	cache.mu.Lock()
+	if cache.requireListener && !cache.listening {
+		cache.stats.Misses++
+		cache.mu.Unlock()
+		return load()
+	}
+	if entry, ok := entries()[key]; ok && time.Now().Before(entry.expiresAt) {
+		cache.stats.Hits++
+		cache.mu.Unlock()
+		return entry.value, nil
+	}
+	cache.stats.Misses++
+	generation := cache.generation
+	cache.mu.Unlock()
+
+	value, httpErr := load()
+	if httpErr != nil {
+		return value, httpErr
+	}
+
+	cache.mu.Lock()
+	if cache.generation == generation {
+		entries()[key] = cacheEntry[V]{value: value, expiresAt: time.Now().Add(cache.ttl)}
+	}
+	cache.mu.Unlock()
+
+	return value, nil
+}
+
+func (cache *CachingHandlersRepository) GetSpecification(handlerID string) (Specification, *http_tools.Error) {
+	spec, httpErr := cachedLoad(cache, func() map[string]cacheEntry[Specification] { return cache.specs }, handlerID,
+		func() (Specification, *http_tools.Error) {
+			return cache.Repository.GetSpecification(handlerID)
+		})
+	if httpErr != nil {
+		return Specification{}, httpErr
+	}
+
+	// callers append to the slices of the specification, the cached one must stay intact
+	return cloneSpecification(spec), nil
+}
+
+func (cache *CachingHandlersRepository) GetHandlerStatus(handlerID string) (HandlerStatus, *http_tools.Error) {
+	return cachedLoad(cache, func() map[string]cacheEntry[HandlerStatus] { return cache.statuses }, handlerID,
+		func() (HandlerStatus, *http_tools.Error) {
+			return cache.Repository.GetHandlerStatus(handlerID)
+		})
+}
+
+func (cache *CachingHandlersRepository) GetHandlerIDByName(name string) (string, *http_tools.Error) {
+	return cachedLoad(cache, func() map[string]cacheEntry[string] { return cache.names }, name,
+		func() (string, *http_tools.Error) {
+			return cache.Repository.GetHandlerIDByName(name)
+		})
+}
+
+func (cache *CachingHandlersRepository) RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.RenewLease(handlerID, expiresAt)
+}
+
+func (cache *CachingHandlersRepository) AddMethods(handlerID string, methods []Method) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.AddMethods(handlerID, methods)
+}
+
+func (cache *CachingHandlersRepository) AddInstances(handlerID string, instances []Instance) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.AddInstances(handlerID, instances)
+}
+
+func (cache *CachingHandlersRepository) SetHandlerState(handlerID, state string) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.SetHandlerState(handlerID, state)
+}
+
+func (cache *CachingHandlersRepository) RemoveHandler(handlerID string) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.RemoveHandler(handlerID)
+}
+
+func (cache *CachingHandlersRepository) UpdateHandler(handlerID string, specification Specification) *http_tools.Error {
+	defer cache.Invalidate(handlerID)
+	return cache.Repository.UpdateHandler(handlerID, specification)
+}
+
+func (cache *CachingHandlersRepository) DeactivateExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	handlerIDs, httpErr := cache.Repository.DeactivateExpiredLeases(now)
+	for _, handlerID := range handlerIDs {
+		cache.Invalidate(handlerID)
+	}
+	return handlerIDs, httpErr
+}
+
+func (cache *CachingHandlersRepository) RetireExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	handlerIDs, httpErr := cache.Repository.RetireExpiredLeases(now)
+	for _, handlerID := range handlerIDs {
+		cache.Invalidate(handlerID)
+	}
+	return handlerIDs, httpErr
+}
+
+// RunInTx invalidates handlers changed inside the transaction once it is over, reads inside it bypass the cache
+func (cache *CachingHandlersRepository) RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error {
+	tx := &cachingTx{changed: make(map[string]bool)}
+	httpErr := cache.Repository.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		tx.handlersRepo = repo
+		return fn(tx)
+	})
+
+	for handlerID := range tx.changed {
+		cache.Invalidate(handlerID)
+	}
+
+	return httpErr
+}
+
+// cachingTx remembers the handlers changed inside a transaction
+type cachingTx struct {
+	handlersRepo
+	changed map[string]bool
+}
+
+func (tx *cachingTx) RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error {
+	return fn(tx)
+}
+
+func (tx *cachingTx) RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.RenewLease(handlerID, expiresAt)
+}
+
+func (tx *cachingTx) AddMethods(handlerID string, methods []Method) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.AddMethods(handlerID, methods)
+}
+
+func (tx *cachingTx) AddInstances(handlerID string, instances []Instance) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.AddInstances(handlerID, instances)
+}
+
+func (tx *cachingTx) SetHandlerState(handlerID, state string) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.SetHandlerState(handlerID, state)
+}
+
+func (tx *cachingTx) RemoveHandler(handlerID string) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.RemoveHandler(handlerID)
+}
+
+func (tx *cachingTx) UpdateHandler(handlerID string, specification Specification) *http_tools.Error {
+	tx.changed[handlerID] = true
+	return tx.handlersRepo.UpdateHandler(handlerID, specification)
+}
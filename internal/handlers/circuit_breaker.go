@@ -0,0 +1,385 @@
+package handlers
+
+import (
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	BreakerClosed   = "closed"
+	BreakerOpen     = "open"
+	BreakerHalfOpen = "half_open"
+)
+
+// BreakerConfig is shared by the breakers of handlers and instances. A breaker opens when either rate reaches
+// its threshold in the window or after EjectAfter failures in a row, an open breaker fails calls at once.
+type BreakerConfig struct {
+	// Window is the number of the latest calls the rates are computed over
+	Window int
+	// MinCalls must be made before the rates can open the breaker
+	MinCalls    int
+	FailureRate float64
+	// SlowCall is the time to the response headers above which a call counts as slow
+	SlowCall     time.Duration
+	SlowCallRate float64
+	// EjectAfter is the number of failures in a row which open the breaker regardless of the rates
+	EjectAfter int
+	// OpenFor is how long an open breaker fails calls before trial calls are let through
+	OpenFor time.Duration
+	// HalfOpenCalls is the number of trial calls which must succeed to close the breaker
+	HalfOpenCalls int
+	// MaxEjection caps the time an instance is ejected for, it grows by OpenFor with every ejection in a row
+	MaxEjection time.Duration
+}
+
+var DefaultBreakerConfig = BreakerConfig{
+	Window:        20,
+	MinCalls:      10,
+	FailureRate:   0.5,
+	SlowCall:      3 * time.Second,
+	SlowCallRate:  0.8,
+	EjectAfter:    5,
+	OpenFor:       30 * time.Second,
+	HalfOpenCalls: 3,
+	MaxEjection:   5 * time.Minute,
+}
+
+type BreakerStatus struct {
+	State string `json:"state"`
+	// OpenUntil is set for open breakers
+	OpenUntil           *time.Time `json:"open_until,omitempty"`
+	Calls               int        `json:"calls"`
+	FailureRate         float64    `json:"failure_rate"`
+	SlowCallRate        float64    `json:"slow_call_rate"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	// Trips counts the times the breaker opened since it was closed last
+	Trips int `json:"trips"`
+}
+
+type InstanceBreakerStatus struct {
+	Socket string `json:"socket"`
+	BreakerStatus
+}
+
+type HandlerBreakers struct {
+	Handler   BreakerStatus           `json:"handler"`
+	Instances []InstanceBreakerStatus `json:"instances"`
+}
+
+type callOutcome struct {
+	failed bool
+	slow   bool
+}
+
+type breaker struct {
+	state string
+	// generation changes with the state, so outcomes of calls started before are told apart
+	generation int
+	// outcomes is a ring of the latest calls made while the breaker was closed
+	outcomes            []callOutcome
+	next                int
+	consecutiveFailures int
+	openUntil           time.Time
+	trips               int
+	trialsInFlight      int
+	trialSuccesses      int
+}
+
+func newBreaker(window int) *breaker {
+	return &breaker{state: BreakerClosed, outcomes: make([]callOutcome, 0, window)}
+}
+
+// refresh lets trial calls through once the breaker has been open long enough
+func (b *breaker) refresh(now time.Time) {
+	if b.state == BreakerOpen && !now.Before(b.openUntil) {
+		b.state = BreakerHalfOpen
+		b.generation++
+		b.trialsInFlight, b.trialSuccesses = 0, 0
+	}
+}
+
+// admits tells whether a call may be made now, or how long the caller should wait for it
+func (b *breaker) admits(now time.Time, config BreakerConfig) (bool, time.Duration) {
+	b.refresh(now)
+	switch b.state {
+	case BreakerOpen:
+		return false, b.openUntil.Sub(now)
+	case BreakerHalfOpen:
+		// the trial calls are short, another one is likely to be let through soon
+		return b.trialsInFlight+b.trialSuccesses < config.HalfOpenCalls, time.Second
+	}
+	return true, 0
+}
+
+func (b *breaker) rates() (float64, float64) {
+	if len(b.outcomes) == 0 {
+		return 0, 0
+	}
+
+	failed, slow := 0, 0
+	for _, outcome := range b.outcomes {
+		if outcome.failed {
+			failed++
+		}
+		if outcome.slow {
+			slow++
+		}
+	}
+	return float64(failed) / float64(len(b.outcomes)), float64(slow) / float64(len(b.outcomes))
+}
+
+// record updates the breaker with the outcome of a call started in the given generation and tells whether
+// the state changed. Outcomes of calls started before the last change are late and don't count.
+func (b *breaker) record(generation int, outcome callOutcome, now time.Time, config BreakerConfig,
+	growingEjection bool) bool {
+	if generation != b.generation {
+		return false
+	}
+
+	if outcome.failed {
+		b.consecutiveFailures++
+	} else {
+		b.consecutiveFailures = 0
+	}
+
+	if b.state == BreakerHalfOpen {
+		b.trialsInFlight--
+		if outcome.failed || outcome.slow {
+			b.open(now, config, growingEjection)
+			return true
+		}
+		b.trialSuccesses++
+		if b.trialSuccesses >= config.HalfOpenCalls {
+			b.state = BreakerClosed
+			b.generation++
+			b.trips = 0
+			return true
+		}
+		return false
+	}
+
+	if len(b.outcomes) < config.Window {
+		b.outcomes = append(b.outcomes, outcome)
+	} else {
+		b.outcomes[b.next] = outcome
+	}
+	b.next = (b.next + 1) % config.Window
+
+	failureRate, slowCallRate := b.rates()
+	tripped := config.EjectAfter > 0 && b.consecutiveFailures >= config.EjectAfter ||
+		len(b.outcomes) >= config.MinCalls && (failureRate >= config.FailureRate || slowCallRate >= config.SlowCallRate)
+	if tripped {
+		b.open(now, config, growingEjection)
+	}
+	return tripped
+}
+
+func (b *breaker) open(now time.Time, config BreakerConfig, growingEjection bool) {
+	b.state = BreakerOpen
+	b.generation++
+	b.trips++
+	openFor := config.OpenFor
+	if growingEjection {
+		openFor = time.Duration(b.trips) * config.OpenFor
+		if openFor > config.MaxEjection {
+			openFor = config.MaxEjection
+		}
+	}
+	b.openUntil = now.Add(openFor)
+	b.outcomes = b.outcomes[:0]
+	b.next = 0
+}
+
+func (b *breaker) status(now time.Time) BreakerStatus {
+	b.refresh(now)
+	failureRate, slowCallRate := b.rates()
+	status := BreakerStatus{
+		State:               b.state,
+		Calls:               len(b.outcomes),
+		FailureRate:         failureRate,
+		SlowCallRate:        slowCallRate,
+		ConsecutiveFailures: b.consecutiveFailures,
+		Trips:               b.trips,
+	}
+	if b.state == BreakerOpen {
+		openUntil := b.openUntil
+		status.OpenUntil = &openUntil
+	}
+	return status
+}
+
+// circuitBreakers keeps a breaker per handler, which stops calls to the handler as a whole, and a breaker
+// per instance socket, which ejects the instance from balancing. State is kept by every replica on its own.
+type circuitBreakers struct {
+	logger    common.Logger
+	config    BreakerConfig
+	mu        sync.Mutex
+	handlers  map[string]*breaker
+	instances map[string]*breaker
+}
+
+func newCircuitBreakers(logger common.Logger, config BreakerConfig) *circuitBreakers {
+	return &circuitBreakers{
+		logger:    logger,
+		config:    config,
+		handlers:  make(map[string]*breaker),
+		instances: make(map[string]*breaker),
+	}
+}
+
+// SetBreakerConfig replaces DefaultBreakerConfig, the state of the breakers is reset
+func (service *Service) SetBreakerConfig(config BreakerConfig) {
+	service.breakers = newCircuitBreakers(service.logger, config)
+}
+
+func (breakers *circuitBreakers) breaker(registry map[string]*breaker, key string) *breaker {
+	b, ok := registry[key]
+	if !ok {
+		b = newBreaker(breakers.config.Window)
+		registry[key] = b
+	}
+	return b
+}
+
+// admit picks the instance of the handler to call among the instances which may be called now, a call fails
+// with circuit_open if the breaker of the handler is open or every instance is ejected. Trial calls of half-open
+// breakers are counted right away, so concurrent calls can't exceed HalfOpenCalls. The returned call must be
+// either finished once the response headers are received or cancelled if the instance is not called.
+func (breakers *circuitBreakers) admit(handlerID string, instances []Instance,
+	pick func([]Instance) (Instance, error)) (*admittedCall, *http_tools.Error) {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	now := time.Now()
+	handlerBreaker := breakers.breaker(breakers.handlers, handlerID)
+	if ok, retryAfter := handlerBreaker.admits(now, breakers.config); !ok {
+		return nil, circuitOpenError("circuit breaker of the handler is open", retryAfter)
+	}
+
+	admitted := make([]Instance, 0, len(instances))
+	var retryAfter time.Duration
+	for _, instance := range instances {
+		ok, wait := breakers.breaker(breakers.instances, instance.Socket).admits(now, breakers.config)
+		if ok {
+			admitted = append(admitted, instance)
+		} else if retryAfter == 0 || wait < retryAfter {
+			retryAfter = wait
+		}
+	}
+	if len(admitted) == 0 {
+		return nil, circuitOpenError("all instances of the handler are ejected", retryAfter)
+	}
+
+	instance, err := pick(admitted)
+	if err != nil {
+		return nil, &http_tools.Error{Type: http_tools.UnavailableError, Info: err.Error()}
+	}
+
+	instanceBreaker := breakers.breaker(breakers.instances, instance.Socket)
+	handlerBreaker.reserveTrial()
+	instanceBreaker.reserveTrial()
+	return &admittedCall{
+		breakers:           breakers,
+		handlerID:          handlerID,
+		instance:           instance,
+		handlerBreaker:     handlerBreaker,
+		instanceBreaker:    instanceBreaker,
+		handlerGeneration:  handlerBreaker.generation,
+		instanceGeneration: instanceBreaker.generation,
+		startedAt:          now,
+	}, nil
+}
+
+// reserveTrial counts a call let through a half-open breaker as a trial call in flight
+func (b *breaker) reserveTrial() {
+	if b.state == BreakerHalfOpen {
+		b.trialsInFlight++
+	}
+}
+
+// releaseTrial gives back the trial call reserved in the given generation by a call which was not made
+func (b *breaker) releaseTrial(generation int) {
+	if b.state == BreakerHalfOpen && b.generation == generation {
+		b.trialsInFlight--
+	}
+}
+
+// admittedCall is a call to the instance let through by the breakers of the handler and of the instance
+type admittedCall struct {
+	breakers                              *circuitBreakers
+	handlerID                             string
+	instance                              Instance
+	handlerBreaker, instanceBreaker       *breaker
+	handlerGeneration, instanceGeneration int
+	startedAt                             time.Time
+}
+
+// finish updates the breakers with the outcome of the call
+func (call *admittedCall) finish(failed bool) {
+	breakers := call.breakers
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	now := time.Now()
+	outcome := callOutcome{failed: failed, slow: now.Sub(call.startedAt) > breakers.config.SlowCall}
+	if call.handlerBreaker.record(call.handlerGeneration, outcome, now, breakers.config, false) {
+		breakers.logger.Warn("circuit breaker of handler ", call.handlerID, " is ", call.handlerBreaker.state)
+	}
+	if call.instanceBreaker.record(call.instanceGeneration, outcome, now, breakers.config, true) {
+		breakers.logger.Warn("circuit breaker of instance ", call.instance.Socket, " of handler ", call.handlerID,
+			" is ", call.instanceBreaker.state)
+	}
+}
+
+// cancel releases the trial calls reserved for a call which was not made, its outcome doesn't count
+func (call *admittedCall) cancel() {
+	call.breakers.mu.Lock()
+	defer call.breakers.mu.Unlock()
+
+	call.handlerBreaker.releaseTrial(call.handlerGeneration)
+	call.instanceBreaker.releaseTrial(call.instanceGeneration)
+}
+
+func (breakers *circuitBreakers) status(handlerID string, instances []Instance) HandlerBreakers {
+	breakers.mu.Lock()
+	defer breakers.mu.Unlock()
+
+	now := time.Now()
+	result := HandlerBreakers{
+		Handler:   breakers.breaker(breakers.handlers, handlerID).status(now),
+		Instances: make([]InstanceBreakerStatus, 0, len(instances)),
+	}
+	for _, instance := range instances {
+		result.Instances = append(result.Instances, InstanceBreakerStatus{
+			Socket:        instance.Socket,
+			BreakerStatus: breakers.breaker(breakers.instances, instance.Socket).status(now),
+		})
+	}
+
+	return result
+}
+
+func circuitOpenError(info string, retryAfter time.Duration) *http_tools.Error {
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.FormatFloat(math.Max(1, math.Ceil(retryAfter.Seconds())), 'f', 0, 64))
+	return &http_tools.Error{Type: http_tools.CircuitOpenError, Info: info, Headers: headers}
+}
+
+// GetCircuitBreakers reports the breakers of the handler and of its instances as seen by this replica, the key
+// must be the owner key of the handler or an admin key
+func (service *Service) GetCircuitBreakers(handlerRef, key string) (HandlerBreakers, *http_tools.Error) {
+	handlerID, spec, httpErr := service.GetSpecification(handlerRef)
+	if httpErr != nil {
+		return HandlerBreakers{}, httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return HandlerBreakers{}, httpErr
+	}
+
+	return service.breakers.status(handlerID, spec.Instances), nil
+}
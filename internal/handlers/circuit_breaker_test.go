@@ -0,0 +1,249 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"go.uber.org/zap"
+)
+
+var testBreakerConfig = BreakerConfig{
+	Window:        10,
+	MinCalls:      4,
+	FailureRate:   0.5,
+	SlowCall:      time.Second,
+	SlowCallRate:  0.5,
+	EjectAfter:    3,
+	OpenFor:       time.Minute,
+	HalfOpenCalls: 2,
+	MaxEjection:   5 * time.Minute,
+}
+
+func TestBreakerRecord(t *testing.T) {
+	ok, failed, slow := callOutcome{}, callOutcome{failed: true}, callOutcome{slow: true}
+
+	tests := []struct {
+		name     string
+		outcomes []callOutcome
+		want     string
+	}{
+		{name: "successes", outcomes: []callOutcome{ok, ok, ok, ok, ok}, want: BreakerClosed},
+		{name: "failures in a row", outcomes: []callOutcome{ok, failed, failed, failed}, want: BreakerOpen},
+		{name: "failures apart below the rate", outcomes: []callOutcome{failed, ok, ok, ok, failed, ok},
+			want: BreakerClosed},
+		{name: "failure rate", outcomes: []callOutcome{failed, ok, failed, ok}, want: BreakerOpen},
+		{name: "failure rate before min calls", outcomes: []callOutcome{failed, ok, failed}, want: BreakerClosed},
+		{name: "slow call rate", outcomes: []callOutcome{slow, ok, slow, ok}, want: BreakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(testBreakerConfig.Window)
+			now := time.Now()
+			for _, outcome := range tt.outcomes {
+				b.record(b.generation, outcome, now, testBreakerConfig, false)
+			}
+			if b.state != tt.want {
+				t.Errorf("state = %s, want %s", b.state, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerEjectionGrows(t *testing.T) {
+	b := newBreaker(testBreakerConfig.Window)
+	now := time.Now()
+
+	for trips, want := range []time.Duration{time.Minute, 2 * time.Minute, 3 * time.Minute, 4 * time.Minute,
+		5 * time.Minute, 5 * time.Minute} {
+		b.open(now, testBreakerConfig, true)
+		if got := b.openUntil.Sub(now); got != want {
+			t.Errorf("ejection %d lasts %s, want %s", trips+1, got, want)
+		}
+	}
+}
+
+func TestCircuitBreakersAdmit(t *testing.T) {
+	const handlerID = "handler"
+	first, second := Instance{Socket: "http://first"}, Instance{Socket: "http://second"}
+
+	tests := []struct {
+		name string
+		// openHandler and openInstances are opened before the call, halfOpen ones are past their OpenFor already
+		openHandler   bool
+		openInstances []string
+		halfOpen      bool
+		// admitted is the number of calls admitted before the checked one, they are still in flight
+		admitted int
+		want     []string
+		wantErr  string
+	}{
+		{name: "closed breakers admit every instance", want: []string{first.Socket, second.Socket}},
+		{name: "open handler breaker", openHandler: true, wantErr: http_tools.CircuitOpenError},
+		{name: "ejected instance is skipped", openInstances: []string{first.Socket}, want: []string{second.Socket}},
+		{name: "every instance ejected", openInstances: []string{first.Socket, second.Socket},
+			wantErr: http_tools.CircuitOpenError},
+		{name: "half-open instance admits a trial call", openInstances: []string{first.Socket, second.Socket},
+			halfOpen: true, admitted: 1, want: []string{first.Socket, second.Socket}},
+		{name: "half-open instances admit no more trial calls than configured",
+			openInstances: []string{first.Socket, second.Socket}, halfOpen: true, admitted: 4,
+			wantErr: http_tools.CircuitOpenError},
+		{name: "half-open handler admits no more trial calls than configured", openHandler: true, halfOpen: true,
+			admitted: 2, wantErr: http_tools.CircuitOpenError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers := newCircuitBreakers(zap.NewNop().Sugar(), testBreakerConfig)
+			now := time.Now()
+			openUntil := now.Add(time.Minute)
+			if tt.halfOpen {
+				openUntil = now.Add(-time.Second)
+			}
+			if tt.openHandler {
+				b := breakers.breaker(breakers.handlers, handlerID)
+				b.open(now, testBreakerConfig, false)
+				b.openUntil = openUntil
+			}
+			for _, socket := range tt.openInstances {
+				b := breakers.breaker(breakers.instances, socket)
+				b.open(now, testBreakerConfig, true)
+				b.openUntil = openUntil
+			}
+
+			// the balancer is stubbed with picking the first admitted instance, so the trial calls go to the
+			// first half-open instance until its budget is spent
+			var offered []Instance
+			pick := func(instances []Instance) (Instance, error) {
+				offered = instances
+				return instances[0], nil
+			}
+			for i := 0; i < tt.admitted; i++ {
+				if _, httpErr := breakers.admit(handlerID, []Instance{first, second}, pick); httpErr != nil {
+					t.Fatalf("admit() of call %d error = %v", i+1, httpErr)
+				}
+			}
+
+			offered = nil
+			_, httpErr := breakers.admit(handlerID, []Instance{first, second}, pick)
+			if tt.wantErr != "" {
+				if httpErr == nil || httpErr.Type != tt.wantErr {
+					t.Fatalf("admit() error = %v, want %s", httpErr, tt.wantErr)
+				}
+				if httpErr.Headers.Get("Retry-After") == "" {
+					t.Errorf("admit() error has no Retry-After header")
+				}
+				return
+			}
+			if httpErr != nil {
+				t.Fatalf("admit() error = %v", httpErr)
+			}
+
+			sockets := make([]string, 0, len(offered))
+			for _, instance := range offered {
+				sockets = append(sockets, instance.Socket)
+			}
+			if len(sockets) != len(tt.want) {
+				t.Fatalf("admitted instances = %v, want %v", sockets, tt.want)
+			}
+			for i := range sockets {
+				if sockets[i] != tt.want[i] {
+					t.Fatalf("admitted instances = %v, want %v", sockets, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestCircuitBreakersTrialCalls(t *testing.T) {
+	const handlerID = "handler"
+	instance := Instance{Socket: "http://instance"}
+	pick := func(instances []Instance) (Instance, error) {
+		return instances[0], nil
+	}
+
+	tests := []struct {
+		name string
+		// finish is called for each trial call with the outcome, nil cancels the call instead
+		finish []*bool
+		want   string
+		// wantAdmitted tells whether one more call is admitted afterwards
+		wantAdmitted bool
+	}{
+		{name: "trial calls in flight", finish: []*bool{}, want: BreakerHalfOpen},
+		{name: "cancelled trial call gives its slot back", finish: []*bool{nil}, want: BreakerHalfOpen,
+			wantAdmitted: true},
+		{name: "successful trial calls close the breaker", finish: []*bool{boolPtr(false), boolPtr(false)},
+			want: BreakerClosed, wantAdmitted: true},
+		{name: "failed trial call opens the breaker", finish: []*bool{boolPtr(false), boolPtr(true)},
+			want: BreakerOpen},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			breakers := newCircuitBreakers(zap.NewNop().Sugar(), testBreakerConfig)
+			b := breakers.breaker(breakers.instances, instance.Socket)
+			b.open(time.Now(), testBreakerConfig, true)
+			b.openUntil = time.Now().Add(-time.Second)
+
+			calls := make([]*admittedCall, 0, testBreakerConfig.HalfOpenCalls)
+			for i := 0; i < testBreakerConfig.HalfOpenCalls; i++ {
+				call, httpErr := breakers.admit(handlerID, []Instance{instance}, pick)
+				if httpErr != nil {
+					t.Fatalf("admit() of trial call %d error = %v", i+1, httpErr)
+				}
+				calls = append(calls, call)
+			}
+			for i, failed := range tt.finish {
+				if failed == nil {
+					calls[i].cancel()
+				} else {
+					calls[i].finish(*failed)
+				}
+			}
+
+			if b.state != tt.want {
+				t.Errorf("state = %s, want %s", b.state, tt.want)
+			}
+			_, httpErr := breakers.admit(handlerID, []Instance{instance}, pick)
+			if admitted := httpErr == nil; admitted != tt.wantAdmitted {
+				t.Errorf("next call admitted = %v, want %v", admitted, tt.wantAdmitted)
+			}
+		})
+	}
+}
+
+func TestCircuitBreakersLateOutcome(t *testing.T) {
+	const handlerID = "handler"
+	instance := Instance{Socket: "http://instance"}
+	pick := func(instances []Instance) (Instance, error) {
+		return instances[0], nil
+	}
+	breakers := newCircuitBreakers(zap.NewNop().Sugar(), testBreakerConfig)
+
+	late, httpErr := breakers.admit(handlerID, []Instance{instance}, pick)
+	if httpErr != nil {
+		t.Fatalf("admit() error = %v", httpErr)
+	}
+	b := breakers.breaker(breakers.instances, instance.Socket)
+	b.open(time.Now(), testBreakerConfig, true)
+	b.openUntil = time.Now().Add(-time.Second)
+	if _, httpErr = breakers.admit(handlerID, []Instance{instance}, pick); httpErr != nil {
+		t.Fatalf("admit() of the trial call error = %v", httpErr)
+	}
+
+	// the call admitted before the breaker opened must neither close it nor free a trial slot
+	late.finish(false)
+	if b.trialsInFlight != 1 || b.trialSuccesses != 0 {
+		t.Errorf("trials in flight = %d, successes = %d, want 1 and 0", b.trialsInFlight, b.trialSuccesses)
+	}
+	late.cancel()
+	if b.trialsInFlight != 1 {
+		t.Errorf("trials in flight after cancel = %d, want 1", b.trialsInFlight)
+	}
+}
+
+func boolPtr(value bool) *bool {
+	return &value
+}
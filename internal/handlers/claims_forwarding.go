@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	// claimHeaderPrefix is followed by the claim name, string claims are passed as they are and other claims as JSON
+	claimHeaderPrefix = "X-Claim-"
+	// claimsSignatureHeader holds "t=<unix time>,v1=<signature>", the signature is a hex HMAC-SHA256 of the lines
+	// "<unix time>", "<handler ID>", "<method> <path>" followed by the lines "<lowercase claim name>:<header value>"
+	// of the forwarded claims sorted bytewise, each line ends with "\n"
+	claimsSignatureHeader = "X-Claims-Signature"
+)
+
+var claimNameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.-]+$`)
+
+// SetClaimsSigningKey sets the key the forwarded claims are signed with, handlers can't forward claims without it
+func (service *Service) SetClaimsSigningKey(key []byte) {
+	service.claimsSigningKey = key
+}
+
+// checkForwardClaims makes sure the claims can be put into header names and can be signed
+func (service *Service) checkForwardClaims(names []string) *http_tools.Error {
+	if len(names) == 0 {
+		return nil
+	}
+	if len(service.claimsSigningKey) == 0 {
+		return &http_tools.Error{Type: http_tools.ValidationError,
+			Info: "claims can't be forwarded, the registry has no claims signing key"}
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		if !claimNameRegexp.MatchString(name) {
+			return &http_tools.Error{Type: http_tools.ValidationError, Info: "claim " + name +
+				" can't be forwarded, only letters, digits, dots, dashes and underscores are allowed"}
+		}
+		if seen[strings.ToLower(name)] {
+			return &http_tools.Error{Type: http_tools.ValidationError, Info: "claim " + name + " is listed twice"}
+		}
+		seen[strings.ToLower(name)] = true
+	}
+
+	return nil
+}
+
+// forwardClaims sets the headers of the claims the handler asked for and signs them. The signature is sent
+// even if the token has none of them, so the handler can tell a call without claims from a forged one.
+func (service *Service) forwardClaims(req *http.Request, handlerID, path string, names []string, claims jwt.Claims) {
+	if len(names) == 0 || claims == nil || len(service.claimsSigningKey) == 0 {
+		return
+	}
+
+	lines := make([]string, 0, len(names))
+	for _, name := range names {
+		claim, ok := claims[name]
+		if !ok {
+			continue
+		}
+		value, err := claimHeaderValue(claim)
+		if err != nil {
+			service.logger.Warn("claim ", name, " can't be forwarded: ", err)
+			continue
+		}
+
+		req.Header.Set(claimHeaderPrefix+name, value)
+		lines = append(lines, strings.ToLower(name)+":"+value+"\n")
+	}
+	sort.Strings(lines)
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+	mac := hmac.New(sha256.New, service.claimsSigningKey)
+	mac.Write([]byte(timestamp + "\n" + handlerID + "\n" + req.Method + " " + path + "\n" + strings.Join(lines, "")))
+	req.Header.Set(claimsSignatureHeader, "t="+timestamp+",v1="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+// claimHeaderValue encodes strings with control characters as JSON too, since they can't be put into a header
+func claimHeaderValue(claim any) (string, error) {
+	if value, ok := claim.(string); ok && strings.IndexFunc(value, unicode.IsControl) == -1 {
+		return value, nil
+	}
+
+	encoded, err := json.Marshal(claim)
+	if err != nil {
+		return "", err
+	}
+	return string(encoded), nil
+}
@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DefaultMaxValidatedBody is the size of the largest response body which is validated, larger ones are passed
+// through unchecked
+const DefaultMaxValidatedBody int64 = 1 << 20
+
+// responseSchemaKeyRegexp matches keys of Method.ResponseSchemas: a status code, a status class or "default"
+var responseSchemaKeyRegexp = regexp.MustCompile(`^(?:[1-5][0-9]{2}|[1-5]XX|default)$`)
+
+// MethodViolations counts responses of a handler method which did not match its response schemas
+type MethodViolations struct {
+	PathPart      string    `json:"path_part"`
+	MethodType    string    `json:"method_type"`
+	Count         int64     `json:"count"`
+	LastStatus    int       `json:"last_status"`
+	LastViolation time.Time `json:"last_violation"`
+	LastError     string    `json:"last_error"`
+	// Unvalidated counts responses passed through unchecked because their bodies were too large
+	Unvalidated int64 `json:"unvalidated"`
+}
+
+// contractViolations keeps the counters in memory, so every replica reports only the calls it proxied
+type contractViolations struct {
+	mu       sync.Mutex
+	counters map[string]map[string]*MethodViolations
+}
+
+func newContractViolations() *contractViolations {
+	return &contractViolations{counters: make(map[string]map[string]*MethodViolations)}
+}
+
+// SetMaxValidatedBody replaces DefaultMaxValidatedBody
+func (service *Service) SetMaxValidatedBody(size int64) {
+	service.maxValidatedBody = size
+}
+
+// SetSchemaCacheSize replaces DefaultSchemaCacheSize
+func (service *Service) SetSchemaCacheSize(size int) {
+	service.schemaValidator = NewSchemaValidator(size)
+}
+
+func (violations *contractViolations) record(handlerID string, method Method, status int, message string) {
+	violations.mu.Lock()
+	defer violations.mu.Unlock()
+
+	counter := violations.counter(handlerID, method)
+	counter.Count++
+	counter.LastStatus = status
+	counter.LastViolation = time.Now()
+	counter.LastError = message
+}
+
+func (violations *contractViolations) recordUnvalidated(handlerID string, method Method) {
+	violations.mu.Lock()
+	defer violations.mu.Unlock()
+
+	violations.counter(handlerID, method).Unvalidated++
+}
+
+func (violations *contractViolations) counter(handlerID string, method Method) *MethodViolations {
+	methods, ok := violations.counters[handlerID]
+	if !ok {
+		methods = make(map[string]*MethodViolations)
+		violations.counters[handlerID] = methods
+	}
+
+	key := method.MethodType + " " + method.PathPart
+	counter, ok := methods[key]
+	if !ok {
+		counter = &MethodViolations{PathPart: method.PathPart, MethodType: method.MethodType}
+		methods[key] = counter
+	}
+	return counter
+}
+
+func (violations *contractViolations) get(handlerID string) []MethodViolations {
+	violations.mu.Lock()
+	defer violations.mu.Unlock()
+
+	result := make([]MethodViolations, 0, len(violations.counters[handlerID]))
+	for _, counter := range violations.counters[handlerID] {
+		result = append(result, *counter)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].PathPart != result[j].PathPart {
+			return result[i].PathPart < result[j].PathPart
+		}
+		return result[i].MethodType < result[j].MethodType
+	})
+
+	return result
+}
+
+// responseSchema picks the schema declared for the status code, an exact code wins over a class like "2XX",
+// which wins over "default"
+func (method Method) responseSchema(status int) []byte {
+	code := strconv.Itoa(status)
+	if schema, ok := method.ResponseSchemas[code]; ok {
+		return schema
+	}
+	if schema, ok := method.ResponseSchemas[code[:1]+"XX"]; ok {
+		return schema
+	}
+	return method.ResponseSchemas["default"]
+}
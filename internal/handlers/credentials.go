@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"strings"
+)
+
+// ownerKeyPrefix makes owner keys easy to tell apart from other secrets, for example in leaked configs
+const ownerKeyPrefix = "hok_"
+
+// Authors of revisions made with keys are recorded as the kind of the key and the beginning of its hash
+const (
+	adminKeyAuthor      = "admin"
+	ownerKeyAuthor      = "owner"
+	anonymousAuthor     = "anonymous"
+	keyAuthorHashLength = 12
+)
+
+// newOwnerKey returns a random owner key and the hash it is stored as, the key itself is never stored
+func newOwnerKey() (string, string, *http_tools.Error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", &http_tools.Error{Type: http_tools.UnavailableError,
+			Info: "owner key can't be generated: " + err.Error()}
+	}
+
+	key := ownerKeyPrefix + base64.RawURLEncoding.EncodeToString(secret)
+	return key, hashOwnerKey(key), nil
+}
+
+// hashOwnerKey doesn't need a salt or stretching, the keys are random and long enough to resist brute force
+func hashOwnerKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func sameHash(a, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// SetAdminKeys sets the keys accepted instead of the owner key of any handler
+func (service *Service) SetAdminKeys(keys []string) {
+	service.adminKeyHashes = make([]string, 0, len(keys))
+	for _, key := range keys {
+		if key = strings.TrimSpace(key); key != "" {
+			service.adminKeyHashes = append(service.adminKeyHashes, hashOwnerKey(key))
+		}
+	}
+}
+
+// authorize makes sure the key is either the owner key of the handler or an admin key. Handlers registered
+// before owner keys existed have no owner key, so only admin keys can change them.
+func (service *Service) authorize(handlerID, key string) *http_tools.Error {
+	_, httpErr := service.authenticate(handlerID, key)
+	return httpErr
+}
+
+// authenticate authorizes the key like authorize and names the key it is, the name is recorded as the author
+// of the revisions made with the key instead of the author claimed by the caller
+func (service *Service) authenticate(handlerID, key string) (string, *http_tools.Error) {
+	if key == "" {
+		httpErr := &http_tools.Error{Type: http_tools.UnauthorizedError, Info: "owner key is required"}
+		service.logger.Error(httpErr)
+		return "", httpErr
+	}
+
+	keyHash := hashOwnerKey(key)
+	if service.isAdminKeyHash(keyHash) {
+		return keyAuthor(adminKeyAuthor, keyHash), nil
+	}
+
+	ownerKeyHash, httpErr := service.handlersRepo.GetOwnerKeyHash(handlerID)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", httpErr
+	}
+	if ownerKeyHash == "" || !sameHash(keyHash, ownerKeyHash) {
+		httpErr = &http_tools.Error{Type: http_tools.UnauthorizedError, Info: "owner key is invalid"}
+		service.logger.Error(httpErr)
+		return "", httpErr
+	}
+
+	return keyAuthor(ownerKeyAuthor, keyHash), nil
+}
+
+// registrationAuthor names the author of a new handler, registrations need no key, so the author claimed by
+// the caller is trusted only while the registry has no admin keys configured
+func (service *Service) registrationAuthor(key, claimedAuthor string) string {
+	if key != "" {
+		if keyHash := hashOwnerKey(key); service.isAdminKeyHash(keyHash) {
+			return keyAuthor(adminKeyAuthor, keyHash)
+		}
+	}
+	if len(service.adminKeyHashes) > 0 {
+		return anonymousAuthor
+	}
+	return claimedAuthor
+}
+
+// keyAuthor identifies a key by the beginning of its hash, which tells keys apart without revealing them
+func keyAuthor(kind, keyHash string) string {
+	return kind + ":" + keyHash[:keyAuthorHashLength]
+}
+
+// AuthorizeAdmin makes sure the key is an admin key, it guards the diagnostics which span all handlers
+func (service *Service) AuthorizeAdmin(key string) *http_tools.Error {
+	if key == "" || !service.isAdminKeyHash(hashOwnerKey(key)) {
+		httpErr := &http_tools.Error{Type: http_tools.UnauthorizedError, Info: "admin key is required"}
+		service.logger.Error(httpErr)
+		return httpErr
+	}
+	return nil
+}
+
+func (service *Service) isAdminKeyHash(keyHash string) bool {
+	for _, adminKeyHash := range service.adminKeyHashes {
+		if sameHash(keyHash, adminKeyHash) {
+			return true
+		}
+	}
+	return false
+}
+
+// RotateOwnerKey issues a new owner key of the handler, the previous one stops working right away
+func (service *Service) RotateOwnerKey(handlerRef, key string) (string, string, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return "", "", httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return "", "", httpErr
+	}
+	if httpErr = service.checkNotRetired(handlerID); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	ownerKey, ownerKeyHash, httpErr := newOwnerKey()
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+	if httpErr = service.handlersRepo.SetOwnerKeyHash(handlerID, ownerKeyHash); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	return handlerID, ownerKey, nil
+}
+
+// TransferOwnership hands the handler over to another owner. The owner key is rotated along with it,
+// so the previous owner loses access, and the change is recorded as a new revision.
+func (service *Service) TransferOwnership(handlerRef, owner, key string) (string, string, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return "", "", httpErr
+	}
+	author, httpErr := service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return "", "", httpErr
+	}
+	if httpErr = service.checkNotRetired(handlerID); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	ownerKey, ownerKeyHash, httpErr := newOwnerKey()
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	httpErr = service.handlersRepo.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		spec, httpErr := repo.GetSpecification(handlerID)
+		if httpErr != nil {
+			return httpErr
+		}
+		spec.Owner = owner
+
+		if httpErr = repo.UpdateHandler(handlerID, spec); httpErr != nil {
+			return httpErr
+		}
+		if _, httpErr = repo.AddRevision(handlerID, spec, author, nil); httpErr != nil {
+			return httpErr
+		}
+
+		return repo.SetOwnerKeyHash(handlerID, ownerKeyHash)
+	})
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	service.observers.notify(handlerID)
+
+	return handlerID, ownerKey, nil
+}
@@ -0,0 +1,65 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type addInstanceDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string            `json:"handler_id" validate:"required"`
+	Instance  handlers.Instance `json:"instance"`
+}
+
+type instanceAdder interface {
+	AddInstance(handlerRef string, instance handlers.Instance, key string) *http_tools.Error
+}
+
+type AddInstanceHandler struct {
+	logger   common.Logger
+	service  instanceAdder
+	validate *validator.Validate
+}
+
+func NewAddInstanceHandler(logger common.Logger, service instanceAdder, validate *validator.Validate) *AddInstanceHandler {
+	return &AddInstanceHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *AddInstanceHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/instances/add request received")
+
+	var dto addInstanceDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	err := handler.service.AddInstance(dto.HandlerID, dto.Instance, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusNoContent)
+}
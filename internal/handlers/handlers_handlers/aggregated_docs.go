@@ -0,0 +1,48 @@
+package handlers_handlers
+
+import (
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type aggregatedDocsProvider interface {
+	Document() ([]byte, string, *http_tools.Error)
+}
+
+type AggregatedDocsHandler struct {
+	logger     common.Logger
+	aggregator aggregatedDocsProvider
+}
+
+func NewAggregatedDocsHandler(logger common.Logger, aggregator aggregatedDocsProvider) *AggregatedDocsHandler {
+	return &AggregatedDocsHandler{
+		logger:     logger,
+		aggregator: aggregator,
+	}
+}
+
+func (handler *AggregatedDocsHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/swagger-handlers/doc.json request received")
+
+	document, version, err := handler.aggregator.Document()
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	serveDocument(c, document, version)
+}
+
+// serveDocument sends the document with its version as the ETag, clients which already have it get 304
+func serveDocument(c *gin.Context, document []byte, version string) {
+	etag := `"` + version + `"`
+	c.Header("ETag", etag)
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	c.Data(http.StatusOK, "application/json", document)
+}
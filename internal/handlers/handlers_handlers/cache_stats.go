@@ -0,0 +1,43 @@
+package handlers_handlers
+
+import (
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+type cacheStatsProvider interface {
+	Stats() handlers.CacheStats
+}
+
+type adminAuthorizer interface {
+	AuthorizeAdmin(key string) *http_tools.Error
+}
+
+type CacheStatsHandler struct {
+	logger  common.Logger
+	service adminAuthorizer
+	cache   cacheStatsProvider
+}
+
+func NewCacheStatsHandler(logger common.Logger, service adminAuthorizer, cache cacheStatsProvider) *CacheStatsHandler {
+	return &CacheStatsHandler{
+		logger:  logger,
+		service: service,
+		cache:   cache,
+	}
+}
+
+func (handler *CacheStatsHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/cache-stats request received")
+
+	// the stats span all handlers, so only admin keys are accepted
+	if err := handler.service.AuthorizeAdmin(c.GetHeader(OwnerKeyHeader)); err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, handler.cache.Stats())
+}
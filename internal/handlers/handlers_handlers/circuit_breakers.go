@@ -0,0 +1,65 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type circuitBreakersDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+}
+
+type circuitBreakersProvider interface {
+	GetCircuitBreakers(handlerRef, key string) (handlers.HandlerBreakers, *http_tools.Error)
+}
+
+type CircuitBreakersHandler struct {
+	logger   common.Logger
+	service  circuitBreakersProvider
+	validate *validator.Validate
+}
+
+func NewCircuitBreakersHandler(logger common.Logger, service circuitBreakersProvider,
+	validate *validator.Validate) *CircuitBreakersHandler {
+	return &CircuitBreakersHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *CircuitBreakersHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/circuit-breakers request received")
+
+	var dto circuitBreakersDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	breakers, err := handler.service.GetCircuitBreakers(dto.HandlerID, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, breakers)
+}
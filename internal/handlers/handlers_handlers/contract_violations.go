@@ -0,0 +1,69 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type contractViolationsDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+}
+
+type contractViolationsOutDTO struct {
+	Violations []handlers.MethodViolations `json:"violations"`
+}
+
+type contractViolationsProvider interface {
+	GetContractViolations(handlerRef, key string) ([]handlers.MethodViolations, *http_tools.Error)
+}
+
+type ContractViolationsHandler struct {
+	logger   common.Logger
+	service  contractViolationsProvider
+	validate *validator.Validate
+}
+
+func NewContractViolationsHandler(logger common.Logger, service contractViolationsProvider,
+	validate *validator.Validate) *ContractViolationsHandler {
+	return &ContractViolationsHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *ContractViolationsHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/contract-violations request received")
+
+	var dto contractViolationsDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	violations, err := handler.service.GetContractViolations(dto.HandlerID, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, contractViolationsOutDTO{Violations: violations})
+}
@@ -0,0 +1,65 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type getRevisionDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+	Revision  int    `json:"revision" validate:"required,min=1"`
+}
+
+type revisionProvider interface {
+	GetRevision(handlerRef string, revision int) (handlers.Revision, *http_tools.Error)
+}
+
+type GetRevisionHandler struct {
+	logger   common.Logger
+	service  revisionProvider
+	validate *validator.Validate
+}
+
+func NewGetRevisionHandler(logger common.Logger, service revisionProvider, validate *validator.Validate) *GetRevisionHandler {
+	return &GetRevisionHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *GetRevisionHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/revision request received")
+
+	var dto getRevisionDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	revision, err := handler.service.GetRevision(dto.HandlerID, dto.Revision)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, revision)
+}
@@ -5,30 +5,50 @@ import (
 	"github.com/educ-educ/handlers-service/internal/handlers"
 	"github.com/educ-educ/handlers-service/internal/pkg/common"
 	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"net/http"
 )
 
 type getSpecDTO struct {
+	// HandlerID is either the handler ID or its name
 	HandlerID string `json:"handler_id" validate:"required"`
+	// ForCaller hides the methods the caller is not allowed to call
+	ForCaller bool `json:"for_caller,omitempty"`
+}
+
+type getSpecOutDTO struct {
+	HandlerID string `json:"handler_id"`
+	handlers.Specification
+	Status handlers.HandlerStatus `json:"status"`
+	Health handlers.HandlerHealth `json:"health"`
 }
 
 type handlerSpecProvider interface {
-	GetSpecification(handlerID string) (handlers.Specification, *http_tools.Error)
+	GetSpecification(handlerRef string) (string, handlers.Specification, *http_tools.Error)
+	GetStatus(handlerID string) (handlers.HandlerStatus, *http_tools.Error)
+	VisibleMethods(specification handlers.Specification, claims jwt.Claims) handlers.Specification
+}
+
+type handlerHealthProvider interface {
+	GetHealth(spec handlers.Specification) handlers.HandlerHealth
 }
 
 type GetSpecHandler struct {
-	logger   common.Logger
-	service  handlerSpecProvider
-	validate *validator.Validate
+	logger         common.Logger
+	service        handlerSpecProvider
+	healthProvider handlerHealthProvider
+	validate       *validator.Validate
 }
 
-func NewGetSpecHandler(logger common.Logger, service handlerSpecProvider, validate *validator.Validate) *GetSpecHandler {
+func NewGetSpecHandler(logger common.Logger, service handlerSpecProvider, healthProvider handlerHealthProvider,
+	validate *validator.Validate) *GetSpecHandler {
 	return &GetSpecHandler{
-		logger:   logger,
-		service:  service,
-		validate: validate,
+		logger:         logger,
+		service:        service,
+		healthProvider: healthProvider,
+		validate:       validate,
 	}
 }
 
@@ -53,11 +73,26 @@ func (handler *GetSpecHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	spec, err := handler.service.GetSpecification(dto.HandlerID)
+	handlerID, spec, err := handler.service.GetSpecification(dto.HandlerID)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	if dto.ForCaller {
+		spec = handler.service.VisibleMethods(spec, jwt.ClaimsFrom(c))
+	}
+
+	status, err := handler.service.GetStatus(handlerID)
 	if err != nil {
 		_ = c.Error(err.AsGinError())
 		return
 	}
 
-	c.JSON(http.StatusOK, spec)
+	c.JSON(http.StatusOK, getSpecOutDTO{
+		HandlerID:     handlerID,
+		Specification: spec,
+		Status:        status,
+		Health:        handler.healthProvider.GetHealth(spec),
+	})
 }
@@ -0,0 +1,44 @@
+package handlers_handlers
+
+import (
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+)
+
+type handlerDocsProvider interface {
+	HandlerDocument(handlerID string, spec handlers.Specification) ([]byte, string, *http_tools.Error)
+}
+
+type HandlerDocsHandler struct {
+	logger     common.Logger
+	service    handlerSpecProvider
+	aggregator handlerDocsProvider
+}
+
+func NewHandlerDocsHandler(logger common.Logger, service handlerSpecProvider, aggregator handlerDocsProvider) *HandlerDocsHandler {
+	return &HandlerDocsHandler{
+		logger:     logger,
+		service:    service,
+		aggregator: aggregator,
+	}
+}
+
+func (handler *HandlerDocsHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/swagger-handlers/:handler/doc.json request received")
+
+	handlerID, spec, err := handler.service.GetSpecification(c.Param("handler"))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	document, version, err := handler.aggregator.HandlerDocument(handlerID, spec)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	serveDocument(c, document, version)
+}
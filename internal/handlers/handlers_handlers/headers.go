@@ -0,0 +1,10 @@
+package handlers_handlers
+
+const (
+	// AuthorHeader names the person or system registering a handler, it is stored in the revision history only while
+	// no admin keys are configured, other changes are attributed to the key they are made with
+	AuthorHeader = "X-Author"
+	// OwnerKeyHeader carries the owner key issued on registration or an admin key, it is required to change a handler
+	// or to read its diagnostics
+	OwnerKeyHeader = "X-Owner-Key"
+)
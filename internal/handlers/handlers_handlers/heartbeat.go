@@ -0,0 +1,68 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+	"time"
+)
+
+type heartbeatDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+}
+
+type heartbeatOutDTO struct {
+	LeaseExpiresAt time.Time `json:"lease_expires_at"`
+}
+
+type leaseRenewer interface {
+	Heartbeat(handlerRef, key string) (time.Time, *http_tools.Error)
+}
+
+type HeartbeatHandler struct {
+	logger   common.Logger
+	service  leaseRenewer
+	validate *validator.Validate
+}
+
+func NewHeartbeatHandler(logger common.Logger, service leaseRenewer, validate *validator.Validate) *HeartbeatHandler {
+	return &HeartbeatHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *HeartbeatHandler) Handle(c *gin.Context) {
+	handler.logger.Debug("/handlers/heartbeat request received")
+
+	var dto heartbeatDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	expiresAt, err := handler.service.Heartbeat(dto.HandlerID, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, heartbeatOutDTO{LeaseExpiresAt: expiresAt})
+}
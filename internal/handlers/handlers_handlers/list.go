@@ -0,0 +1,67 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"io"
+	"net/http"
+)
+
+type listHandlersOutDTO struct {
+	Handlers   []handlers.HandlerSummary `json:"handlers"`
+	NextCursor string                    `json:"next_cursor,omitempty"`
+}
+
+type handlersLister interface {
+	ListHandlers(filter handlers.HandlersFilter) ([]handlers.HandlerSummary, string, *http_tools.Error)
+}
+
+type ListHandler struct {
+	logger   common.Logger
+	service  handlersLister
+	validate *validator.Validate
+}
+
+func NewListHandler(logger common.Logger, service handlersLister, validate *validator.Validate) *ListHandler {
+	return &ListHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *ListHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/list request received")
+
+	// an empty body lists the first page of all handlers
+	var dto handlers.HandlersFilter
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil && !errors.Is(err, io.EOF) {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	summaries, nextCursor, err := handler.service.ListHandlers(dto)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, listHandlersOutDTO{Handlers: summaries, NextCursor: nextCursor})
+}
@@ -0,0 +1,68 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type listRevisionsDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+}
+
+type listRevisionsOutDTO struct {
+	Revisions []handlers.RevisionInfo `json:"revisions"`
+}
+
+type revisionsLister interface {
+	ListRevisions(handlerRef string) ([]handlers.RevisionInfo, *http_tools.Error)
+}
+
+type ListRevisionsHandler struct {
+	logger   common.Logger
+	service  revisionsLister
+	validate *validator.Validate
+}
+
+func NewListRevisionsHandler(logger common.Logger, service revisionsLister, validate *validator.Validate) *ListRevisionsHandler {
+	return &ListRevisionsHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *ListRevisionsHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/revisions request received")
+
+	var dto listRevisionsDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	revisions, err := handler.service.ListRevisions(dto.HandlerID)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, listRevisionsOutDTO{Revisions: revisions})
+}
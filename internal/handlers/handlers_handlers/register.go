@@ -12,10 +12,12 @@ import (
 
 type registerHandlerOutDTO struct {
 	HandlerID string `json:"handler_id"`
+	// OwnerKey is required to change the handler later, it is returned only once
+	OwnerKey string `json:"owner_key"`
 }
 
 type handlerRegistrant interface {
-	Register(specification handlers.Specification) (string, *http_tools.Error)
+	Register(specification handlers.Specification, author string) (string, string, *http_tools.Error)
 }
 
 type RegisterHandler struct {
@@ -53,11 +55,11 @@ func (handler *RegisterHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	handlerID, err := handler.service.Register(dto)
+	handlerID, ownerKey, err := handler.service.Register(dto, c.GetHeader(AuthorHeader))
 	if err != nil {
 		_ = c.Error(err.AsGinError())
 		return
 	}
 
-	c.JSON(http.StatusOK, registerHandlerOutDTO{HandlerID: handlerID})
+	c.JSON(http.StatusOK, registerHandlerOutDTO{HandlerID: handlerID, OwnerKey: ownerKey})
 }
@@ -0,0 +1,89 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type registerOpenAPIDTO struct {
+	// Document is an OpenAPI 3 document in JSON or YAML, methods of the specification are derived from its paths
+	Document string `json:"document" validate:"required"`
+	// Specification holds the socket and the rest of the handler settings, its methods must be omitted
+	Specification handlers.Specification `json:"specification" validate:"-"`
+}
+
+type openAPIRegistrant interface {
+	SpecificationFromOpenAPI(document []byte, base handlers.Specification) (handlers.Specification, *http_tools.Error)
+	Register(specification handlers.Specification, author string) (string, string, *http_tools.Error)
+}
+
+type RegisterOpenAPIHandler struct {
+	logger   common.Logger
+	service  openAPIRegistrant
+	validate *validator.Validate
+}
+
+func NewRegisterOpenAPIHandler(logger common.Logger, service openAPIRegistrant, validate *validator.Validate) *RegisterOpenAPIHandler {
+	return &RegisterOpenAPIHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *RegisterOpenAPIHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/register-openapi request received")
+
+	var dto registerOpenAPIDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	if len(dto.Specification.Methods) > 0 {
+		wrappedErr := http_tools.Error{Type: http_tools.ValidationError, Info: "methods are derived from the document and must be omitted"}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	spec, err := handler.service.SpecificationFromOpenAPI([]byte(dto.Document), dto.Specification)
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(spec); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	handlerID, ownerKey, err := handler.service.Register(spec, c.GetHeader(AuthorHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, registerHandlerOutDTO{HandlerID: handlerID, OwnerKey: ownerKey})
+}
@@ -0,0 +1,64 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type removeInstanceDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+	Socket    string `json:"socket" validate:"required,url"`
+}
+
+type instanceRemover interface {
+	RemoveInstance(handlerRef, socket, key string) *http_tools.Error
+}
+
+type RemoveInstanceHandler struct {
+	logger   common.Logger
+	service  instanceRemover
+	validate *validator.Validate
+}
+
+func NewRemoveInstanceHandler(logger common.Logger, service instanceRemover, validate *validator.Validate) *RemoveInstanceHandler {
+	return &RemoveInstanceHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *RemoveInstanceHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/instances/remove request received")
+
+	var dto removeInstanceDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	err := handler.service.RemoveInstance(dto.HandlerID, dto.Socket, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.Writer.WriteHeader(http.StatusNoContent)
+}
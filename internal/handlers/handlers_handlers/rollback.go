@@ -0,0 +1,68 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type rollbackDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+	Revision  int    `json:"revision" validate:"required,min=1"`
+}
+
+type rollbackOutDTO struct {
+	Revision int `json:"revision"`
+}
+
+type handlerRollbacker interface {
+	Rollback(handlerRef string, revision int, key string) (int, *http_tools.Error)
+}
+
+type RollbackHandler struct {
+	logger   common.Logger
+	service  handlerRollbacker
+	validate *validator.Validate
+}
+
+func NewRollbackHandler(logger common.Logger, service handlerRollbacker, validate *validator.Validate) *RollbackHandler {
+	return &RollbackHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *RollbackHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/rollback request received")
+
+	var dto rollbackDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	revision, err := handler.service.Rollback(dto.HandlerID, dto.Revision, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, rollbackOutDTO{Revision: revision})
+}
@@ -0,0 +1,70 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type rotateOwnerKeyDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+}
+
+type ownerKeyOutDTO struct {
+	HandlerID string `json:"handler_id"`
+	// OwnerKey replaces the previous owner key, it is returned only once
+	OwnerKey string `json:"owner_key"`
+}
+
+type ownerKeyRotator interface {
+	RotateOwnerKey(handlerRef, key string) (string, string, *http_tools.Error)
+}
+
+type RotateOwnerKeyHandler struct {
+	logger   common.Logger
+	service  ownerKeyRotator
+	validate *validator.Validate
+}
+
+func NewRotateOwnerKeyHandler(logger common.Logger, service ownerKeyRotator,
+	validate *validator.Validate) *RotateOwnerKeyHandler {
+	return &RotateOwnerKeyHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *RotateOwnerKeyHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/owner/rotate-key request received")
+
+	var dto rotateOwnerKeyDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	handlerID, ownerKey, err := handler.service.RotateOwnerKey(dto.HandlerID, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, ownerKeyOutDTO{HandlerID: handlerID, OwnerKey: ownerKey})
+}
@@ -0,0 +1,66 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type transferOwnershipDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+	Owner     string `json:"owner" validate:"required,max=256"`
+}
+
+type ownershipTransferrer interface {
+	TransferOwnership(handlerRef, owner, key string) (string, string, *http_tools.Error)
+}
+
+type TransferOwnershipHandler struct {
+	logger   common.Logger
+	service  ownershipTransferrer
+	validate *validator.Validate
+}
+
+func NewTransferOwnershipHandler(logger common.Logger, service ownershipTransferrer,
+	validate *validator.Validate) *TransferOwnershipHandler {
+	return &TransferOwnershipHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+// Handle returns the owner key of the new owner, the key of the previous owner stops working
+func (handler *TransferOwnershipHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/owner/transfer request received")
+
+	var dto transferOwnershipDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	handlerID, ownerKey, err := handler.service.TransferOwnership(dto.HandlerID, dto.Owner, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, ownerKeyOutDTO{HandlerID: handlerID, OwnerKey: ownerKey})
+}
@@ -0,0 +1,71 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type transitionDTO struct {
+	// HandlerID is either the handler ID or its name
+	HandlerID string `json:"handler_id" validate:"required"`
+	State     string `json:"state" validate:"required,oneof=active draining disabled retired"`
+}
+
+type transitionOutDTO struct {
+	HandlerID string `json:"handler_id"`
+	State     string `json:"state"`
+	// InFlight counts calls to the handler proxied by this replica which are not finished yet
+	InFlight int `json:"in_flight"`
+}
+
+type handlerTransitioner interface {
+	Transition(handlerRef, state, key string) (string, int, *http_tools.Error)
+}
+
+type TransitionHandler struct {
+	logger   common.Logger
+	service  handlerTransitioner
+	validate *validator.Validate
+}
+
+func NewTransitionHandler(logger common.Logger, service handlerTransitioner, validate *validator.Validate) *TransitionHandler {
+	return &TransitionHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *TransitionHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/transition request received")
+
+	var dto transitionDTO
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	handlerID, inFlight, err := handler.service.Transition(dto.HandlerID, dto.State, c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, transitionOutDTO{HandlerID: handlerID, State: dto.State, InFlight: inFlight})
+}
@@ -10,11 +10,14 @@ import (
 )
 
 type unregisterHandlerDTO struct {
+	// HandlerID is either the handler ID or its name
 	HandlerID string `json:"handler_id" validate:"required"`
+	// Purge deletes the handler with its history instead of retiring it
+	Purge bool `json:"purge,omitempty"`
 }
 
 type handlerUnregistrant interface {
-	Unregister(handlerID string) *http_tools.Error
+	Unregister(handlerID string, purge bool, key string) *http_tools.Error
 }
 
 type UnregisterHandler struct {
@@ -52,7 +55,7 @@ func (handler *UnregisterHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	err := handler.service.Unregister(dto.HandlerID)
+	err := handler.service.Unregister(dto.HandlerID, dto.Purge, c.GetHeader(OwnerKeyHeader))
 	if err != nil {
 		_ = c.Error(err.AsGinError())
 		return
@@ -11,12 +11,13 @@ import (
 )
 
 type updateDTO struct {
+	// HandlerID is either the handler ID or its name
 	HandlerID     string                 `json:"handler_id"`
 	Specification handlers.Specification `json:"specification"`
 }
 
 type handlerUpdater interface {
-	Update(handlerID string, specification handlers.Specification) *http_tools.Error
+	Update(handlerRef string, specification handlers.Specification, key string) *http_tools.Error
 }
 
 type UpdateHandler struct {
@@ -54,7 +55,7 @@ func (handler *UpdateHandler) Handle(c *gin.Context) {
 		return
 	}
 
-	err := handler.service.Update(dto.HandlerID, dto.Specification)
+	err := handler.service.Update(dto.HandlerID, dto.Specification, c.GetHeader(OwnerKeyHeader))
 	if err != nil {
 		_ = c.Error(err.AsGinError())
 		return
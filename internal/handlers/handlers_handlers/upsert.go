@@ -0,0 +1,68 @@
+package handlers_handlers
+
+import (
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/handlers"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"net/http"
+)
+
+type upsertHandlerOutDTO struct {
+	HandlerID string `json:"handler_id"`
+	// Action is created, updated or unchanged
+	Action string `json:"action"`
+	// OwnerKey is returned only when the handler is created
+	OwnerKey string `json:"owner_key,omitempty"`
+}
+
+type handlerUpserter interface {
+	Upsert(specification handlers.Specification, author, key string) (string, string, string, *http_tools.Error)
+}
+
+type UpsertHandler struct {
+	logger   common.Logger
+	service  handlerUpserter
+	validate *validator.Validate
+}
+
+func NewUpsertHandler(logger common.Logger, service handlerUpserter, validate *validator.Validate) *UpsertHandler {
+	return &UpsertHandler{
+		logger:   logger,
+		service:  service,
+		validate: validate,
+	}
+}
+
+func (handler *UpsertHandler) Handle(c *gin.Context) {
+	handler.logger.Info("/handlers/upsert request received")
+
+	var dto handlers.Specification
+	if err := json.NewDecoder(c.Request.Body).Decode(&dto); err != nil {
+		handler.logger.Error(err.Error())
+		wrappedErr := http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		_ = c.Error(wrappedErr.AsGinError())
+		return
+	}
+
+	if err := handler.validate.Struct(dto); err != nil {
+		handler.logger.Error(err.Error())
+		for _, err := range err.(validator.ValidationErrors) {
+			wrappedError := http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			_ = c.Error(wrappedError.AsGinError())
+		}
+
+		return
+	}
+
+	handlerID, action, ownerKey, err := handler.service.Upsert(dto, c.GetHeader(AuthorHeader),
+		c.GetHeader(OwnerKeyHeader))
+	if err != nil {
+		_ = c.Error(err.AsGinError())
+		return
+	}
+
+	c.JSON(http.StatusOK, upsertHandlerOutDTO{HandlerID: handlerID, Action: action, OwnerKey: ownerKey})
+}
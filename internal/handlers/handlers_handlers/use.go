@@ -3,8 +3,10 @@ package handlers_handlers
 import (
 	"errors"
 	"fmt"
+	"github.com/educ-educ/handlers-service/internal/handlers"
 	"github.com/educ-educ/handlers-service/internal/pkg/common"
 	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"io"
@@ -12,7 +14,8 @@ import (
 )
 
 type handlerProvider interface {
-	UseHandler(handlerID, path, method string, body io.Reader) (*http.Response, *http_tools.Error)
+	UseHandler(handlerID, path, method string, body io.Reader, caller handlers.Caller) (*http.Response,
+		*http_tools.Error)
 }
 
 type UseHandler struct {
@@ -73,7 +76,9 @@ func (handler *UseHandler) Handle(c *gin.Context) {
 		}
 	}
 
-	response, httpErr := handler.service.UseHandler(mapValues[keys[0]], mapValues[keys[1]], mapValues[keys[2]], body)
+	caller := handlers.Caller{Claims: jwt.ClaimsFrom(c), IP: c.ClientIP()}
+	response, httpErr := handler.service.UseHandler(mapValues[keys[0]], mapValues[keys[1]], mapValues[keys[2]], body,
+		caller)
 	if httpErr != nil {
 		_ = c.Error(httpErr.AsGinError())
 		return
@@ -86,6 +91,7 @@ func (handler *UseHandler) Handle(c *gin.Context) {
 		}
 	}()
 
+	c.Header(handlers.RetryCountHeader, response.Header.Get(handlers.RetryCountHeader))
 	c.Writer.WriteHeader(response.StatusCode)
 	if _, err := io.Copy(c.Writer, response.Body); err != nil {
 		handler.logger.Error(err)
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+const (
+	SortByCreatedAt = "created_at"
+	SortByName      = "name"
+	SortBySocket    = "socket"
+)
+
+const defaultListLimit = 20
+
+type HandlersFilter struct {
+	// SocketHost matches handlers with at least one instance on the host
+	SocketHost string `json:"socket_host,omitempty" validate:"omitempty,hostname_rfc1123|ip"`
+	// PathContains matches handlers with at least one method path containing the substring
+	PathContains string `json:"path_contains,omitempty"`
+	// MethodType matches handlers with at least one method of the type, combined with PathContains
+	// both must hold for the same method
+	MethodType string `json:"method_type,omitempty"`
+	// State matches handlers in the lifecycle state, retired handlers are listed only when asked for explicitly
+	State      string `json:"state,omitempty" validate:"omitempty,oneof=pending active draining disabled retired"`
+	SortBy     string `json:"sort_by,omitempty" validate:"omitempty,oneof=created_at name socket"`
+	Descending bool   `json:"descending,omitempty"`
+	Limit      int    `json:"limit,omitempty" validate:"omitempty,min=1,max=100"`
+	// Cursor is the next_cursor of the previous page, the other fields must stay the same between pages
+	Cursor string `json:"cursor,omitempty"`
+}
+
+type HandlerSummary struct {
+	HandlerID      string    `json:"handler_id"`
+	Name           string    `json:"name,omitempty"`
+	Description    string    `json:"description,omitempty"`
+	Owner          string    `json:"owner,omitempty"`
+	Tags           []string  `json:"tags,omitempty"`
+	Socket         string    `json:"socket"`
+	InstancesCount int       `json:"instances_count"`
+	MethodsCount   int       `json:"methods_count"`
+	State          string    `json:"state"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+// listCursor points right after the last handler of a page
+type listCursor struct {
+	SortKey   string `json:"k"`
+	HandlerID string `json:"id"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+func encodeCursor(cursor listCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(encoded string) (listCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return listCursor{}, errInvalidCursor
+	}
+
+	var cursor listCursor
+	if err = json.Unmarshal(raw, &cursor); err != nil || cursor.HandlerID == "" {
+		return listCursor{}, errInvalidCursor
+	}
+
+	return cursor, nil
+}
+
+// sortKey returns the value of the summary the list is ordered by, it is stored in cursors
+func (summary HandlerSummary) sortKey(sortBy string) string {
+	switch sortBy {
+	case SortByName:
+		return summary.Name
+	case SortBySocket:
+		return summary.Socket
+	default:
+		return summary.CreatedAt.UTC().Format(time.RFC3339Nano)
+	}
+}
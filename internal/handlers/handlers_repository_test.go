@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/migrations"
+	"github.com/educ-educ/handlers-service/internal/pkg/sqlite"
+	"go.uber.org/zap"
+)
+
+// repositoryBackends builds an empty repository of every backend which runs without external services
+var repositoryBackends = map[string]func(t *testing.T) Repository{
+	"memory": func(t *testing.T) Repository {
+		return NewMemoryHandlersRepository()
+	},
+	"sqlite": func(t *testing.T) Repository {
+		logger := zap.NewNop().Sugar()
+		db, closeDB, err := sqlite.NewSQLiteDb("sqlite://" + t.TempDir() + "/registry.db")
+		if err != nil {
+			t.Fatalf("NewSQLiteDb() error = %v", err)
+		}
+		t.Cleanup(func() { closeDB(db) })
+
+		migrator, err := migrations.NewMigrator(logger, db, migrations.SQLite, SQLiteMigrations())
+		if err != nil {
+			t.Fatalf("NewMigrator() error = %v", err)
+		}
+		if err = migrator.Up(context.Background()); err != nil {
+			t.Fatalf("Up() error = %v", err)
+		}
+
+		return NewSQLiteHandlersRepository(logger, context.Background(), db)
+	},
+}
+
+// addTestHandler registers a handler with its primary socket as the only instance
+func addTestHandler(t *testing.T, repo Repository, specification Specification) string {
+	t.Helper()
+
+	handlerID, httpErr := repo.AddHandlerInstance(specification)
+	if httpErr != nil {
+		t.Fatalf("AddHandlerInstance() error = %v", httpErr)
+	}
+	if httpErr = repo.AddInstances(handlerID, []Instance{{Socket: specification.Socket, Weight: 1}}); httpErr != nil {
+		t.Fatalf("AddInstances() error = %v", httpErr)
+	}
+	return handlerID
+}
+
+func TestRepositoryUniqueErrors(t *testing.T) {
+	const (
+		socket      = "http://localhost:8081"
+		otherSocket = "http://localhost:8082"
+	)
+
+	tests := []struct {
+		name string
+		// change is made after a handler named "grades" holding socket is registered
+		change  func(t *testing.T, repo Repository, existingID string) *http_tools.Error
+		wantErr string
+	}{
+		{
+			name: "registering a taken name",
+			change: func(t *testing.T, repo Repository, _ string) *http_tools.Error {
+				_, httpErr := repo.AddHandlerInstance(Specification{Name: "grades", Socket: otherSocket})
+				return httpErr
+			},
+			wantErr: http_tools.AlreadyExist,
+		},
+		{
+			name: "renaming to a taken name",
+			change: func(t *testing.T, repo Repository, _ string) *http_tools.Error {
+				handlerID := addTestHandler(t, repo, Specification{Name: "courses", Socket: otherSocket})
+				return repo.UpdateHandler(handlerID, Specification{Name: "grades", Socket: otherSocket})
+			},
+			wantErr: http_tools.AlreadyExist,
+		},
+		{
+			name: "reusing the name of a retired handler",
+			change: func(t *testing.T, repo Repository, existingID string) *http_tools.Error {
+				if httpErr := repo.SetHandlerState(existingID, StateRetired); httpErr != nil {
+					t.Fatalf("SetHandlerState() error = %v", httpErr)
+				}
+				_, httpErr := repo.AddHandlerInstance(Specification{Name: "grades", Socket: otherSocket})
+				return httpErr
+			},
+		},
+		{
+			name: "adding a taken socket",
+			change: func(t *testing.T, repo Repository, _ string) *http_tools.Error {
+				handlerID, httpErr := repo.AddHandlerInstance(Specification{Name: "courses", Socket: socket})
+				if httpErr != nil {
+					t.Fatalf("AddHandlerInstance() error = %v", httpErr)
+				}
+				return repo.AddInstances(handlerID, []Instance{{Socket: socket, Weight: 1}})
+			},
+			wantErr: http_tools.ValidationError,
+		},
+		{
+			name: "adding the socket of a pending handler",
+			change: func(t *testing.T, repo Repository, existingID string) *http_tools.Error {
+				if httpErr := repo.SetHandlerState(existingID, StatePending); httpErr != nil {
+					t.Fatalf("SetHandlerState() error = %v", httpErr)
+				}
+				addTestHandler(t, repo, Specification{Name: "courses", Socket: socket})
+				return nil
+			},
+		},
+		{
+			name: "activating a pending handler whose socket was taken",
+			change: func(t *testing.T, repo Repository, existingID string) *http_tools.Error {
+				if httpErr := repo.SetHandlerState(existingID, StatePending); httpErr != nil {
+					t.Fatalf("SetHandlerState() error = %v", httpErr)
+				}
+				addTestHandler(t, repo, Specification{Name: "courses", Socket: socket})
+				return repo.SetHandlerState(existingID, StateActive)
+			},
+			wantErr: http_tools.ValidationError,
+		},
+		{
+			name: "renewing the lease of a pending handler whose socket was taken",
+			change: func(t *testing.T, repo Repository, existingID string) *http_tools.Error {
+				if httpErr := repo.SetHandlerState(existingID, StatePending); httpErr != nil {
+					t.Fatalf("SetHandlerState() error = %v", httpErr)
+				}
+				addTestHandler(t, repo, Specification{Name: "courses", Socket: socket})
+				return repo.RenewLease(existingID, time.Now().Add(time.Minute))
+			},
+			wantErr: http_tools.ValidationError,
+		},
+	}
+
+	for backend, newRepository := range repositoryBackends {
+		for _, tt := range tests {
+			t.Run(backend+"/"+tt.name, func(t *testing.T) {
+				repo := newRepository(t)
+				existingID := addTestHandler(t, repo, Specification{Name: "grades", Socket: socket})
+
+				httpErr := tt.change(t, repo, existingID)
+				if tt.wantErr == "" {
+					if httpErr != nil {
+						t.Fatalf("error = %v, want none", httpErr)
+					}
+					return
+				}
+				if httpErr == nil || httpErr.Type != tt.wantErr {
+					t.Fatalf("error = %v, want %s", httpErr, tt.wantErr)
+				}
+			})
+		}
+	}
+}
@@ -9,27 +9,68 @@ import (
 )
 
 type Validator struct {
-	logger common.Logger
+	logger          common.Logger
+	defaultTimeouts Timeouts
 }
 
 func NewValidator(logger common.Logger) *Validator {
-	return &Validator{logger: logger}
+	return &Validator{logger: logger, defaultTimeouts: DefaultTimeouts}
+}
+
+// SetDefaultTimeouts replaces DefaultTimeouts, it should match the defaults of the service
+func (validator *Validator) SetDefaultTimeouts(defaults Timeouts) {
+	validator.defaultTimeouts = defaults
 }
 
 func (validator *Validator) CheckHandler(specification Specification) *http_tools.Error {
-	reqCtx, cancelCtx := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelCtx()
+	for _, instance := range specification.Instances {
+		if httpErr := validator.checkInstance(instance.Socket, specification); httpErr != nil {
+			return httpErr
+		}
+	}
+
+	return nil
+}
+
+// probeTimeout returns the connect timeout of the method and the time a probe of it waits for the response
+// headers, which is the first byte timeout when it is set
+func (validator *Validator) probeTimeout(handler *Timeouts, method Method) (time.Duration, time.Duration) {
+	timeouts := resolveTimeouts(validator.defaultTimeouts, handler, method.Timeouts)
+	if timeouts.firstByte() > 0 && timeouts.firstByte() < timeouts.total() {
+		return timeouts.connect(), timeouts.firstByte()
+	}
+	return timeouts.connect(), timeouts.total()
+}
 
+func (validator *Validator) checkInstance(socket string, specification Specification) *http_tools.Error {
 	for _, method := range specification.Methods {
-		req, err := http.NewRequestWithContext(reqCtx, method.MethodType, specification.Socket+method.PathPart, nil)
+		template, err := ParsePathTemplate(method.PathPart)
+		if err != nil {
+			httpErr := &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+			validator.logger.Error(httpErr)
+			return httpErr
+		}
+
+		// sample parameter values may point to real entities, so templated methods are probed with OPTIONS, which
+		// only tells whether the instance answers
+		probeMethod := method.MethodType
+		if template.HasParams() {
+			probeMethod = http.MethodOptions
+		}
+
+		connectTimeout, timeout := validator.probeTimeout(specification.Timeouts, method)
+		reqCtx, cancelCtx := context.WithTimeout(withConnectTimeout(context.Background(), connectTimeout), timeout)
+		req, err := http.NewRequestWithContext(reqCtx, probeMethod, socket+template.Sample(), nil)
 		if err != nil {
+			cancelCtx()
 			httpErr := &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
 			validator.logger.Error(httpErr)
 			return httpErr
 		}
 
-		resp, err := http.DefaultClient.Do(req)
+		resp, err := upstreamClient.Do(req)
 		if err != nil {
+			cancelCtx()
 			httpErr := &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
 			validator.logger.Error(httpErr)
 			return httpErr
@@ -38,8 +79,10 @@ func (validator *Validator) CheckHandler(specification Specification) *http_tool
 			httpErr := &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
 			validator.logger.Error(httpErr)
 		}
+		cancelCtx()
 
-		if resp.StatusCode == http.StatusNotFound {
+		// Sample parameter values may legitimately point to missing entities, so only literal paths are checked
+		if resp.StatusCode == http.StatusNotFound && !template.HasParams() {
 			httpErr := &http_tools.Error{Type: http_tools.ValidationError, Info: "given method is not found"}
 			validator.logger.Error(httpErr)
 			return httpErr
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	HealthUnknown   = "unknown"
+	HealthHealthy   = "healthy"
+	HealthDegraded  = "degraded"
+	HealthUnhealthy = "unhealthy"
+)
+
+type HealthCheckConfig struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	// HealthyThreshold is the number of successful probes in a row which makes an unhealthy instance healthy
+	HealthyThreshold int
+	// UnhealthyThreshold is the number of failed probes in a row which makes a healthy instance unhealthy
+	UnhealthyThreshold int
+	// HistorySize limits the number of status transitions kept per instance
+	HistorySize int
+}
+
+type HealthTransition struct {
+	Status string    `json:"status"`
+	At     time.Time `json:"at"`
+}
+
+type InstanceHealth struct {
+	Socket    string    `json:"socket"`
+	Status    string    `json:"status"`
+	LastCheck time.Time `json:"last_check"`
+	LastError string    `json:"last_error,omitempty"`
+	// Uptime is the share of the observed time the instance was healthy
+	Uptime      float64            `json:"uptime"`
+	Transitions []HealthTransition `json:"transitions"`
+}
+
+type HandlerHealth struct {
+	Status    string           `json:"status"`
+	Instances []InstanceHealth `json:"instances"`
+}
+
+type specificationsProvider interface {
+	GetAllSpecifications() (map[string]Specification, *http_tools.Error)
+}
+
+type instanceHealthState struct {
+	InstanceHealth
+	successes   int
+	failures    int
+	healthyFor  time.Duration
+	observedFor time.Duration
+}
+
+// HealthChecker periodically probes every instance of every registered handler and reports
+// healthy/unhealthy transitions to the balancer
+type HealthChecker struct {
+	logger    common.Logger
+	repo      specificationsProvider
+	balancer  *Balancer
+	config    HealthCheckConfig
+	client    *http.Client
+	mu        sync.RWMutex
+	instances map[string]*instanceHealthState
+}
+
+func NewHealthChecker(logger common.Logger, repo specificationsProvider, balancer *Balancer, config HealthCheckConfig) *HealthChecker {
+	return &HealthChecker{
+		logger:    logger,
+		repo:      repo,
+		balancer:  balancer,
+		config:    config,
+		client:    &http.Client{Timeout: config.Timeout},
+		instances: make(map[string]*instanceHealthState),
+	}
+}
+
+// Start runs the checks until the context is cancelled
+func (checker *HealthChecker) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(checker.config.Interval)
+		defer ticker.Stop()
+
+		for {
+			checker.checkAll(ctx)
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
+
+// GetHealth returns the health of the handler instances, instances which were not probed yet are unknown
+func (checker *HealthChecker) GetHealth(spec Specification) HandlerHealth {
+	checker.mu.RLock()
+	defer checker.mu.RUnlock()
+
+	health := HandlerHealth{Instances: make([]InstanceHealth, 0, len(spec.Instances))}
+	healthyCount, unhealthyCount := 0, 0
+	for _, instance := range spec.Instances {
+		state, ok := checker.instances[instance.Socket]
+		if !ok {
+			health.Instances = append(health.Instances, InstanceHealth{Socket: instance.Socket, Status: HealthUnknown,
+				Transitions: make([]HealthTransition, 0)})
+			continue
+		}
+
+		instanceHealth := state.InstanceHealth
+		instanceHealth.Transitions = append(make([]HealthTransition, 0, len(state.Transitions)), state.Transitions...)
+		health.Instances = append(health.Instances, instanceHealth)
+
+		switch state.Status {
+		case HealthHealthy:
+			healthyCount++
+		case HealthUnhealthy:
+			unhealthyCount++
+		}
+	}
+
+	switch {
+	case unhealthyCount == len(spec.Instances) && unhealthyCount > 0:
+		health.Status = HealthUnhealthy
+	case unhealthyCount > 0:
+		health.Status = HealthDegraded
+	case healthyCount > 0:
+		health.Status = HealthHealthy
+	default:
+		health.Status = HealthUnknown
+	}
+
+	return health
+}
+
+func (checker *HealthChecker) checkAll(ctx context.Context) {
+	specs, httpErr := checker.repo.GetAllSpecifications()
+	if httpErr != nil {
+		checker.logger.Error("health check skipped: ", httpErr)
+		return
+	}
+
+	probed := make(map[string]bool)
+	var wg sync.WaitGroup
+	for handlerID, spec := range specs {
+		for _, instance := range spec.Instances {
+			probed[instance.Socket] = true
+
+			wg.Add(1)
+			go func(handlerID, socket, healthPath string) {
+				defer wg.Done()
+				checker.record(handlerID, socket, checker.probe(ctx, socket, healthPath))
+			}(handlerID, instance.Socket, spec.HealthPath)
+		}
+	}
+	wg.Wait()
+
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+	for socket := range checker.instances {
+		if !probed[socket] {
+			delete(checker.instances, socket)
+			checker.balancer.SetHealthy(socket, true)
+		}
+	}
+}
+
+func (checker *HealthChecker) probe(ctx context.Context, socket, healthPath string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, socket+healthPath, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := checker.client.Do(req)
+	if err != nil {
+		return err
+	}
+	if err = resp.Body.Close(); err != nil {
+		checker.logger.Error(err)
+	}
+
+	if healthPath != "" && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return fmt.Errorf("health path responded with status %d", resp.StatusCode)
+	}
+	if resp.StatusCode >= 500 {
+		return fmt.Errorf("instance responded with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+func (checker *HealthChecker) record(handlerID, socket string, probeErr error) {
+	checker.mu.Lock()
+	defer checker.mu.Unlock()
+
+	now := time.Now()
+	state, ok := checker.instances[socket]
+	if !ok {
+		state = &instanceHealthState{InstanceHealth: InstanceHealth{Socket: socket, Status: HealthUnknown}}
+		checker.instances[socket] = state
+	}
+
+	if !state.LastCheck.IsZero() {
+		elapsed := now.Sub(state.LastCheck)
+		state.observedFor += elapsed
+		if state.Status == HealthHealthy {
+			state.healthyFor += elapsed
+		}
+	}
+	state.LastCheck = now
+
+	if probeErr == nil {
+		state.successes++
+		state.failures = 0
+		state.LastError = ""
+	} else {
+		state.failures++
+		state.successes = 0
+		state.LastError = probeErr.Error()
+	}
+
+	// the first probe settles the unknown status right away
+	newStatus := state.Status
+	switch {
+	case probeErr == nil && (state.Status != HealthHealthy && state.successes >= checker.config.HealthyThreshold ||
+		state.Status == HealthUnknown):
+		newStatus = HealthHealthy
+	case probeErr != nil && (state.Status != HealthUnhealthy && state.failures >= checker.config.UnhealthyThreshold ||
+		state.Status == HealthUnknown):
+		newStatus = HealthUnhealthy
+	}
+
+	if newStatus != state.Status {
+		checker.logger.Info("handler ", handlerID, " instance ", socket, " became ", newStatus)
+		state.Status = newStatus
+		state.Transitions = append(state.Transitions, HealthTransition{Status: newStatus, At: now})
+		if len(state.Transitions) > checker.config.HistorySize {
+			state.Transitions = state.Transitions[len(state.Transitions)-checker.config.HistorySize:]
+		}
+		checker.balancer.SetHealthy(socket, newStatus != HealthUnhealthy)
+	}
+
+	if state.observedFor > 0 {
+		state.Uptime = float64(state.healthyFor) / float64(state.observedFor)
+	} else if state.Status == HealthHealthy {
+		state.Uptime = 1
+	}
+}
@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"context"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"time"
+)
+
+const (
+	// UnregisterExpired retires handlers with lapsed leases
+	UnregisterExpired = "unregister"
+	// DeactivateExpired moves handlers with lapsed leases back to pending until the next heartbeat
+	DeactivateExpired = "deactivate"
+)
+
+type expiredLeasesRepo interface {
+	DeactivateExpiredLeases(now time.Time) ([]string, *http_tools.Error)
+	RetireExpiredLeases(now time.Time) ([]string, *http_tools.Error)
+}
+
+// LeaseReaper periodically expires handlers registered in the lease mode which stopped sending heartbeats
+type LeaseReaper struct {
+	logger    common.Logger
+	repo      expiredLeasesRepo
+	interval  time.Duration
+	action    string
+	observers registryObservers
+}
+
+func NewLeaseReaper(logger common.Logger, repo expiredLeasesRepo, interval time.Duration, action string) *LeaseReaper {
+	return &LeaseReaper{
+		logger:   logger,
+		repo:     repo,
+		interval: interval,
+		action:   action,
+	}
+}
+
+// AddObserver subscribes the observer to handlers expired by the reaper
+func (reaper *LeaseReaper) AddObserver(observer RegistryObserver) {
+	reaper.observers = append(reaper.observers, observer)
+}
+
+// Start runs the reaper until the context is cancelled
+func (reaper *LeaseReaper) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(reaper.interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reaper.reap()
+			}
+		}
+	}()
+}
+
+func (reaper *LeaseReaper) reap() {
+	var (
+		handlerIDs []string
+		httpErr    *http_tools.Error
+	)
+	if reaper.action == DeactivateExpired {
+		handlerIDs, httpErr = reaper.repo.DeactivateExpiredLeases(time.Now())
+	} else {
+		handlerIDs, httpErr = reaper.repo.RetireExpiredLeases(time.Now())
+	}
+	if httpErr != nil {
+		reaper.logger.Error("lease reaping failed: ", httpErr)
+		return
+	}
+
+	for _, handlerID := range handlerIDs {
+		reaper.logger.Info("lease of handler ", handlerID, " has expired, action: ", reaper.action)
+		reaper.observers.notify(handlerID)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+// Lifecycle states of a handler, only active handlers are proxied to
+const (
+	// StatePending handlers in the lease mode wait for a heartbeat, either the first one or one after
+	// their lease has lapsed
+	StatePending = "pending"
+	StateActive  = "active"
+	// StateDraining handlers reject new calls and let the calls in flight finish
+	StateDraining = "draining"
+	// StateDisabled handlers are kept out of rotation until they are activated again
+	StateDisabled = "disabled"
+	// StateRetired handlers are unregistered, they are kept for their history until purged
+	StateRetired = "retired"
+)
+
+// stateTransitions lists the states a handler may be moved to from each state through Service.Transition,
+// pending handlers become active only by sending a heartbeat, which checks their sockets first
+var stateTransitions = map[string][]string{
+	StatePending:  {StateRetired},
+	StateActive:   {StateDraining, StateDisabled, StateRetired},
+	StateDraining: {StateActive, StateDisabled, StateRetired},
+	StateDisabled: {StateActive, StateRetired},
+	StateRetired:  {},
+}
+
+// initialState is active, unless the handler has to send its first heartbeat
+func initialState(specification Specification) string {
+	if specification.LeaseTTL > 0 {
+		return StatePending
+	}
+	return StateActive
+}
+
+// holdsSockets tells whether sockets of a handler in the state can't be taken by other handlers. Pending handlers
+// don't hold them, so a handler which has lost its lease doesn't block the socket for a new one.
+func holdsSockets(state string) bool {
+	return state != StatePending && state != StateRetired
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"go.uber.org/zap"
+)
+
+func TestStateTransitions(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{from: StatePending, to: StateActive},
+		{from: StatePending, to: StateDraining},
+		{from: StatePending, to: StateDisabled},
+		{from: StatePending, to: StateRetired, want: true},
+		{from: StateActive, to: StatePending},
+		{from: StateActive, to: StateDraining, want: true},
+		{from: StateActive, to: StateDisabled, want: true},
+		{from: StateActive, to: StateRetired, want: true},
+		{from: StateDraining, to: StatePending},
+		{from: StateDraining, to: StateActive, want: true},
+		{from: StateDraining, to: StateDisabled, want: true},
+		{from: StateDraining, to: StateRetired, want: true},
+		{from: StateDisabled, to: StatePending},
+		{from: StateDisabled, to: StateActive, want: true},
+		{from: StateDisabled, to: StateDraining},
+		{from: StateDisabled, to: StateRetired, want: true},
+		{from: StateRetired, to: StatePending},
+		{from: StateRetired, to: StateActive},
+		{from: StateRetired, to: StateDraining},
+		{from: StateRetired, to: StateDisabled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.from+" to "+tt.to, func(t *testing.T) {
+			if got := contains(stateTransitions[tt.from], tt.to); got != tt.want {
+				t.Errorf("transition from %s to %s allowed = %v, want %v", tt.from, tt.to, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHoldsSockets(t *testing.T) {
+	tests := []struct {
+		state string
+		want  bool
+	}{
+		{state: StatePending},
+		{state: StateActive, want: true},
+		{state: StateDraining, want: true},
+		{state: StateDisabled, want: true},
+		{state: StateRetired},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.state, func(t *testing.T) {
+			if got := holdsSockets(tt.state); got != tt.want {
+				t.Errorf("holdsSockets(%s) = %v, want %v", tt.state, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceTransition(t *testing.T) {
+	const adminKey = "admin-key"
+	now := time.Now()
+
+	tests := []struct {
+		name     string
+		leaseTTL int
+		state    string
+		// leaseExpiresAt is set with a heartbeat before the handler is moved to the state
+		leaseExpiresAt time.Time
+		to             string
+		wantErr        string
+	}{
+		{name: "pending handler can't be disabled", leaseTTL: 30, state: StatePending, to: StateDisabled,
+			wantErr: http_tools.ForbiddenActionError},
+		{name: "pending handler can't be activated", leaseTTL: 30, state: StatePending, to: StateActive,
+			wantErr: http_tools.ForbiddenActionError},
+		{name: "disabled handler is activated", state: StateDisabled, to: StateActive},
+		{name: "disabled lease handler with a live lease is activated", leaseTTL: 30, state: StateDisabled,
+			leaseExpiresAt: now.Add(time.Minute), to: StateActive},
+		{name: "disabled lease handler with a lapsed lease can't be activated", leaseTTL: 30, state: StateDisabled,
+			leaseExpiresAt: now.Add(-time.Minute), to: StateActive, wantErr: http_tools.ForbiddenActionError},
+		{name: "disabled lease handler with a lapsed lease is retired", leaseTTL: 30, state: StateDisabled,
+			leaseExpiresAt: now.Add(-time.Minute), to: StateRetired},
+		{name: "retired handler can't be activated", state: StateRetired, to: StateActive,
+			wantErr: http_tools.ForbiddenActionError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			repo := NewMemoryHandlersRepository()
+			service := NewService(zap.NewNop().Sugar(), repo, nil, NewBalancer())
+			service.SetAdminKeys([]string{adminKey})
+
+			handlerID, httpErr := repo.AddHandlerInstance(Specification{Socket: "http://localhost:8081",
+				LeaseTTL: tt.leaseTTL})
+			if httpErr != nil {
+				t.Fatalf("AddHandlerInstance() error = %v", httpErr)
+			}
+			if !tt.leaseExpiresAt.IsZero() {
+				if httpErr = repo.RenewLease(handlerID, tt.leaseExpiresAt); httpErr != nil {
+					t.Fatalf("RenewLease() error = %v", httpErr)
+				}
+			}
+			if httpErr = repo.SetHandlerState(handlerID, tt.state); httpErr != nil {
+				t.Fatalf("SetHandlerState() error = %v", httpErr)
+			}
+
+			_, _, httpErr = service.Transition(handlerID, tt.to, adminKey)
+			if tt.wantErr != "" {
+				if httpErr == nil || httpErr.Type != tt.wantErr {
+					t.Fatalf("Transition() error = %v, want %s", httpErr, tt.wantErr)
+				}
+				return
+			}
+			if httpErr != nil {
+				t.Fatalf("Transition() error = %v", httpErr)
+			}
+
+			status, httpErr := repo.GetHandlerStatus(handlerID)
+			if httpErr != nil {
+				t.Fatalf("GetHandlerStatus() error = %v", httpErr)
+			}
+			if status.State != tt.to {
+				t.Errorf("state = %s, want %s", status.State, tt.to)
+			}
+		})
+	}
+}
@@ -0,0 +1,512 @@
+package handlers
+
+import (
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/google/uuid"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+type memoryHandler struct {
+	spec         Specification
+	status       HandlerStatus
+	createdAt    time.Time
+	revisions    []Revision
+	ownerKeyHash string
+}
+
+// MemoryHandlersRepository keeps the registry in the process memory, it is meant for local development and tests.
+// It behaves like PostgresHandlersRepository including the errors it returns, but the registry is lost on restart
+// and is not shared between replicas.
+type MemoryHandlersRepository struct {
+	// mu is nil for repositories bound to a transaction, the transaction holds the lock of its parent
+	mu       *sync.Mutex
+	handlers map[string]*memoryHandler
+}
+
+func NewMemoryHandlersRepository() *MemoryHandlersRepository {
+	return &MemoryHandlersRepository{
+		mu:       &sync.Mutex{},
+		handlers: make(map[string]*memoryHandler),
+	}
+}
+
+func (repo *MemoryHandlersRepository) lock() func() {
+	if repo.mu == nil {
+		return func() {}
+	}
+	repo.mu.Lock()
+	return repo.mu.Unlock
+}
+
+// RunInTx calls fn with a repository working on a copy of the registry, the copy replaces the registry
+// if fn succeeds. Other calls wait until the transaction is finished.
+func (repo *MemoryHandlersRepository) RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error {
+	if repo.mu == nil {
+		return fn(repo)
+	}
+
+	defer repo.lock()()
+
+	txRepo := &MemoryHandlersRepository{handlers: make(map[string]*memoryHandler, len(repo.handlers))}
+	for handlerID, handler := range repo.handlers {
+		copied := *handler
+		copied.spec = cloneSpecification(handler.spec)
+		copied.revisions = append([]Revision(nil), handler.revisions...)
+		txRepo.handlers[handlerID] = &copied
+	}
+
+	if httpErr := fn(txRepo); httpErr != nil {
+		return httpErr
+	}
+
+	repo.handlers = txRepo.handlers
+	return nil
+}
+
+func (repo *MemoryHandlersRepository) GetUsedSockets() ([]string, *http_tools.Error) {
+	defer repo.lock()()
+
+	sockets := make([]string, 0)
+	for _, handler := range repo.handlers {
+		if !holdsSockets(handler.status.State) {
+			continue
+		}
+		for _, instance := range handler.spec.Instances {
+			sockets = append(sockets, instance.Socket)
+		}
+	}
+
+	return sockets, nil
+}
+
+func (repo *MemoryHandlersRepository) GetSpecification(handlerID string) (Specification, *http_tools.Error) {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return Specification{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return cloneSpecification(handler.spec), nil
+}
+
+// GetAllSpecifications returns specifications of every handler which is not retired keyed by handler ID
+func (repo *MemoryHandlersRepository) GetAllSpecifications() (map[string]Specification, *http_tools.Error) {
+	defer repo.lock()()
+
+	specs := make(map[string]Specification, len(repo.handlers))
+	for handlerID, handler := range repo.handlers {
+		if handler.status.State == StateRetired {
+			continue
+		}
+		specs[handlerID] = cloneSpecification(handler.spec)
+	}
+
+	return specs, nil
+}
+
+func (repo *MemoryHandlersRepository) GetHandlerIDByName(name string) (string, *http_tools.Error) {
+	defer repo.lock()()
+
+	if handlerID, ok := repo.findByName(name); ok {
+		return handlerID, nil
+	}
+
+	return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given name is not found"}
+}
+
+func (repo *MemoryHandlersRepository) findByName(name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for handlerID, handler := range repo.handlers {
+		if handler.spec.Name == name && handler.status.State != StateRetired {
+			return handlerID, true
+		}
+	}
+	return "", false
+}
+
+// ListHandlers returns a page of handler summaries matching the filter and the cursor of the next page,
+// which is empty on the last page
+func (repo *MemoryHandlersRepository) ListHandlers(filter HandlersFilter) ([]HandlerSummary, string, *http_tools.Error) {
+	defer repo.lock()()
+
+	if filter.SortBy == "" {
+		filter.SortBy = SortByCreatedAt
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+
+	var cursor *listCursor
+	if filter.Cursor != "" {
+		decoded, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+		}
+		cursor = &decoded
+	}
+
+	summaries := make([]HandlerSummary, 0)
+	for handlerID, handler := range repo.handlers {
+		if !matchesFilter(handler.spec, handler.status.State, filter) {
+			continue
+		}
+
+		summary := HandlerSummary{
+			HandlerID:      handlerID,
+			Name:           handler.spec.Name,
+			Description:    handler.spec.Description,
+			Owner:          handler.spec.Owner,
+			Tags:           append([]string{}, handler.spec.Tags...),
+			Socket:         handler.spec.Socket,
+			InstancesCount: len(handler.spec.Instances),
+			MethodsCount:   len(handler.spec.Methods),
+			State:          handler.status.State,
+			CreatedAt:      handler.createdAt,
+		}
+		if cursor != nil && !summaryAfter(summary, *cursor, filter) {
+			continue
+		}
+		summaries = append(summaries, summary)
+	}
+
+	sort.Slice(summaries, func(i, j int) bool {
+		if filter.Descending {
+			i, j = j, i
+		}
+		order := compareSortKeys(summaries[i], summaries[j].sortKey(filter.SortBy), filter.SortBy)
+		if order != 0 {
+			return order < 0
+		}
+		return summaries[i].HandlerID < summaries[j].HandlerID
+	})
+
+	nextCursor := ""
+	if len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+		last := summaries[len(summaries)-1]
+		nextCursor = encodeCursor(listCursor{SortKey: last.sortKey(filter.SortBy), HandlerID: last.HandlerID})
+	}
+
+	return summaries, nextCursor, nil
+}
+
+func matchesFilter(spec Specification, state string, filter HandlersFilter) bool {
+	if filter.State != "" && state != filter.State || filter.State == "" && state == StateRetired {
+		return false
+	}
+
+	if filter.SocketHost != "" {
+		found := false
+		for _, instance := range spec.Instances {
+			if socketURL, err := url.Parse(instance.Socket); err == nil &&
+				strings.EqualFold(socketURL.Hostname(), filter.SocketHost) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if filter.PathContains != "" || filter.MethodType != "" {
+		for _, method := range spec.Methods {
+			if strings.Contains(strings.ToLower(method.PathPart), strings.ToLower(filter.PathContains)) &&
+				(filter.MethodType == "" || strings.EqualFold(method.MethodType, filter.MethodType)) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return true
+}
+
+// summaryAfter tells whether the summary comes after the cursor in the list order
+func summaryAfter(summary HandlerSummary, cursor listCursor, filter HandlersFilter) bool {
+	order := compareSortKeys(summary, cursor.SortKey, filter.SortBy)
+	if order == 0 {
+		order = strings.Compare(summary.HandlerID, cursor.HandlerID)
+	}
+	if filter.Descending {
+		return order < 0
+	}
+	return order > 0
+}
+
+// compareSortKeys compares the sort key of the summary with a sort key taken from another summary or a cursor
+func compareSortKeys(summary HandlerSummary, sortKey, sortBy string) int {
+	if sortBy != SortByCreatedAt {
+		return strings.Compare(summary.sortKey(sortBy), sortKey)
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, sortKey)
+	if err != nil {
+		return 1
+	}
+	return summary.CreatedAt.Compare(createdAt)
+}
+
+func (repo *MemoryHandlersRepository) GetHandlerStatus(handlerID string) (HandlerStatus, *http_tools.Error) {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return HandlerStatus{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return handler.status, nil
+}
+
+// RenewLease moves the lease expiry forward and activates the handler if it is pending
+func (repo *MemoryHandlersRepository) RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error {
+	defer repo.lock()()
+
+	if handler, ok := repo.handlers[handlerID]; ok {
+		if handler.status.State == StatePending {
+			if httpErr := repo.checkSocketsUnused(handlerID, handler.spec.Instances); httpErr != nil {
+				return httpErr
+			}
+			handler.status.State = StateActive
+		}
+		handler.status.LeaseExpiresAt = &expiresAt
+	}
+
+	return nil
+}
+
+// DeactivateExpiredLeases moves active handlers whose lease lapsed before now back to pending and returns their IDs
+func (repo *MemoryHandlersRepository) DeactivateExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	defer repo.lock()()
+
+	ids := make([]string, 0)
+	for handlerID, handler := range repo.handlers {
+		if handler.status.State == StateActive && leaseLapsed(handler.status, now) {
+			handler.status.State = StatePending
+			ids = append(ids, handlerID)
+		}
+	}
+
+	return ids, nil
+}
+
+// RetireExpiredLeases retires handlers whose lease lapsed before now and returns their IDs
+func (repo *MemoryHandlersRepository) RetireExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	defer repo.lock()()
+
+	ids := make([]string, 0)
+	for handlerID, handler := range repo.handlers {
+		if handler.status.State != StateRetired && leaseLapsed(handler.status, now) {
+			handler.status.State = StateRetired
+			ids = append(ids, handlerID)
+		}
+	}
+
+	return ids, nil
+}
+
+func leaseLapsed(status HandlerStatus, now time.Time) bool {
+	return status.LeaseExpiresAt != nil && status.LeaseExpiresAt.Before(now)
+}
+
+func (repo *MemoryHandlersRepository) AddHandlerInstance(specification Specification) (string, *http_tools.Error) {
+	defer repo.lock()()
+
+	if _, ok := repo.findByName(specification.Name); ok {
+		return "", &http_tools.Error{Type: http_tools.AlreadyExist, Info: "name is already in use"}
+	}
+
+	spec := cloneSpecification(specification)
+	spec.Methods = make([]Method, 0)
+	spec.Instances = make([]Instance, 0)
+
+	id := uuid.New().String()
+	repo.handlers[id] = &memoryHandler{
+		spec:      spec,
+		status:    HandlerStatus{State: initialState(specification), LeaseExpiresAt: leaseExpiry(specification.LeaseTTL)},
+		createdAt: time.Now(),
+	}
+
+	return id, nil
+}
+
+func (repo *MemoryHandlersRepository) AddMethods(handlerID string, methods []Method) *http_tools.Error {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	handler.spec.Methods = append(handler.spec.Methods, methods...)
+
+	return nil
+}
+
+// AddInstances attaches the instances to the handler, a socket can't be held by two handlers at once
+func (repo *MemoryHandlersRepository) AddInstances(handlerID string, instances []Instance) *http_tools.Error {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	if httpErr := repo.checkSocketsUnused(handlerID, instances); httpErr != nil {
+		return httpErr
+	}
+	handler.spec.Instances = append(handler.spec.Instances, instances...)
+
+	return nil
+}
+
+func (repo *MemoryHandlersRepository) checkSocketsUnused(handlerID string, instances []Instance) *http_tools.Error {
+	for _, instance := range instances {
+		for otherID, other := range repo.handlers {
+			if otherID != handlerID && holdsSockets(other.status.State) && containsSocket(other.spec.Instances, instance.Socket) {
+				return &http_tools.Error{Type: http_tools.ValidationError,
+					Info: "socket " + instance.Socket + " is already in use"}
+			}
+		}
+	}
+
+	return nil
+}
+
+// SetHandlerState moves the handler to the lifecycle state, the transition is checked by the service
+func (repo *MemoryHandlersRepository) SetHandlerState(handlerID, state string) *http_tools.Error {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if holdsSockets(state) && !holdsSockets(handler.status.State) {
+		if httpErr := repo.checkSocketsUnused(handlerID, handler.spec.Instances); httpErr != nil {
+			return httpErr
+		}
+	}
+	handler.status.State = state
+
+	return nil
+}
+
+func (repo *MemoryHandlersRepository) RemoveHandler(handlerID string) *http_tools.Error {
+	defer repo.lock()()
+
+	delete(repo.handlers, handlerID)
+
+	return nil
+}
+
+func (repo *MemoryHandlersRepository) UpdateHandler(handlerID string, specification Specification) *http_tools.Error {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if ownerID, ok := repo.findByName(specification.Name); ok && ownerID != handlerID {
+		return &http_tools.Error{Type: http_tools.AlreadyExist, Info: "name is already in use"}
+	}
+
+	if httpErr := repo.checkSocketsUnused(handlerID, specification.Instances); httpErr != nil {
+		return httpErr
+	}
+
+	handler.spec = cloneSpecification(specification)
+	handler.status.LeaseExpiresAt = leaseExpiry(specification.LeaseTTL)
+
+	return nil
+}
+
+func (repo *MemoryHandlersRepository) AddRevision(handlerID string, specification Specification, author string,
+	rolledBackFrom *int) (int, *http_tools.Error) {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return 0, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	revision := Revision{
+		RevisionInfo: RevisionInfo{
+			Revision:       len(handler.revisions) + 1,
+			Author:         author,
+			RolledBackFrom: rolledBackFrom,
+			CreatedAt:      time.Now(),
+		},
+		Specification: cloneSpecification(specification),
+	}
+	handler.revisions = append(handler.revisions, revision)
+
+	return revision.Revision, nil
+}
+
+func (repo *MemoryHandlersRepository) GetRevisions(handlerID string) ([]RevisionInfo, *http_tools.Error) {
+	defer repo.lock()()
+
+	revisions := make([]RevisionInfo, 0)
+	if handler, ok := repo.handlers[handlerID]; ok {
+		for _, revision := range handler.revisions {
+			revisions = append(revisions, revision.RevisionInfo)
+		}
+	}
+
+	return revisions, nil
+}
+
+func (repo *MemoryHandlersRepository) GetRevision(handlerID string, revisionNumber int) (Revision, *http_tools.Error) {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok || revisionNumber < 1 || revisionNumber > len(handler.revisions) {
+		return Revision{}, &http_tools.Error{Type: http_tools.NotFound, Info: "revision with given number is not found"}
+	}
+
+	revision := handler.revisions[revisionNumber-1]
+	revision.Specification = cloneSpecification(revision.Specification)
+	return revision, nil
+}
+
+// cloneSpecification copies the slices of the specification, so the stored one can't be changed by the caller
+func cloneSpecification(spec Specification) Specification {
+	if spec.Tags != nil {
+		spec.Tags = append([]string{}, spec.Tags...)
+	}
+	if spec.ForwardClaims != nil {
+		spec.ForwardClaims = append([]string{}, spec.ForwardClaims...)
+	}
+	spec.Instances = append(make([]Instance, 0, len(spec.Instances)), spec.Instances...)
+	spec.Methods = append(make([]Method, 0, len(spec.Methods)), spec.Methods...)
+	return spec
+}
+
+func (repo *MemoryHandlersRepository) GetOwnerKeyHash(handlerID string) (string, *http_tools.Error) {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return handler.ownerKeyHash, nil
+}
+
+func (repo *MemoryHandlersRepository) SetOwnerKeyHash(handlerID, hash string) *http_tools.Error {
+	defer repo.lock()()
+
+	handler, ok := repo.handlers[handlerID]
+	if !ok {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	handler.ownerKeyHash = hash
+
+	return nil
+}
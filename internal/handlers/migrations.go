@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"embed"
+	"io/fs"
+)
+
+//go:embed postgres_migrations/*.sql
+var postgresMigrations embed.FS
+
+//go:embed sqlite_migrations/*.sql
+var sqliteMigrations embed.FS
+
+// PostgresMigrations returns the versioned schema of PostgresHandlersRepository to be applied by migrations.Migrator
+func PostgresMigrations() fs.FS {
+	return subFS(postgresMigrations, "postgres_migrations")
+}
+
+// SQLiteMigrations returns the versioned schema of SQLiteHandlersRepository. Table changes are mirrored
+// from the Postgres migrations under the same versions, steps which are Postgres-only, like the change
+// notification triggers, are kept as no-op migrations, so the versions of both backends stay comparable.
+func SQLiteMigrations() fs.FS {
+	return subFS(sqliteMigrations, "sqlite_migrations")
+}
+
+func subFS(fsys embed.FS, dir string) fs.FS {
+	migrations, err := fs.Sub(fsys, dir)
+	if err != nil {
+		panic(err)
+	}
+	return migrations
+}
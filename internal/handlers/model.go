@@ -1,11 +1,146 @@
 package handlers
 
+import (
+	"encoding/json"
+	"time"
+)
+
 type Method struct {
 	PathPart   string `json:"path_part" validate:"required"`
 	MethodType string `json:"method_type" validate:"required"`
+	Summary    string `json:"summary,omitempty" validate:"max=256"`
+	// Metadata holds free-form documentation of the method, like schemas imported from OpenAPI
+	Metadata map[string]json.RawMessage `json:"metadata,omitempty"`
+	// RequestSchema is a JSON Schema the request body is validated against before it is proxied
+	RequestSchema json.RawMessage `json:"request_schema,omitempty"`
+	// ResponseSchemas are JSON Schemas of the response body keyed by status code, like "200", "4XX" or "default"
+	ResponseSchemas map[string]json.RawMessage `json:"response_schemas,omitempty"`
+	// Access restricts the method to callers whose token grants the roles or scopes, anyone may call it when empty
+	Access *MethodAccess `json:"access,omitempty"`
+	// RateLimits apply to the calls of the method on top of the limits of the handler
+	RateLimits *RateLimits `json:"rate_limits,omitempty"`
+	// RetryPolicy replaces the retry policy of the handler for the method
+	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"`
+	// Timeouts override the timeouts of the handler for the method
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+}
+
+// MethodAccess lists what the token of the caller must grant to call the method
+type MethodAccess struct {
+	// Roles are alternatives, any one of them is enough
+	Roles []string `json:"roles,omitempty" validate:"omitempty,dive,required,max=64"`
+	// Scopes are all required
+	Scopes []string `json:"scopes,omitempty" validate:"omitempty,dive,required,max=128"`
+}
+
+// Response validation modes, in the log mode violations are only logged and counted
+const (
+	ResponseValidationOff    = "off"
+	ResponseValidationLog    = "log"
+	ResponseValidationReject = "reject"
+)
+
+const (
+	RoundRobin     = "round_robin"
+	LeastInFlight  = "least_in_flight"
+	WeightedRandom = "weighted_random"
+)
+
+// RateLimit is a token bucket holding up to Burst calls and refilled with Rate calls per second
+type RateLimit struct {
+	Rate float64 `json:"rate" validate:"gt=0"`
+	// Burst defaults to the rate rounded up
+	Burst int `json:"burst,omitempty" validate:"min=0"`
+}
+
+// RateLimits throttle calls made through /handlers/use
+type RateLimits struct {
+	// Total limits the calls of all callers together
+	Total *RateLimit `json:"total,omitempty"`
+	// PerCaller limits every caller separately, callers are told apart by the sub claim of their token or by IP
+	PerCaller *RateLimit `json:"per_caller,omitempty"`
+}
+
+// RetryPolicy repeats calls which failed in a retryable way, waiting a random time up to an exponentially growing
+// backoff between the attempts. All attempts share the deadline of the call.
+type RetryPolicy struct {
+	// MaxAttempts counts the first call too
+	MaxAttempts int `json:"max_attempts" validate:"min=1,max=10"`
+	// BackoffMs is the longest wait before the second attempt, it doubles with every next one up to MaxBackoffMs.
+	// They default to 100 and 2000.
+	BackoffMs    int `json:"backoff_ms,omitempty" validate:"min=0"`
+	MaxBackoffMs int `json:"max_backoff_ms,omitempty" validate:"min=0"`
+	// RetryOnStatuses are the retryable response codes, 502, 503 and 504 by default
+	RetryOnStatuses []int `json:"retry_on_statuses,omitempty" validate:"omitempty,dive,min=100,max=599"`
+	// RetryOnErrors are the retryable kinds of network errors: connect, reset and timeout, connect and reset
+	// by default
+	RetryOnErrors []string `json:"retry_on_errors,omitempty" validate:"omitempty,dive,oneof=connect reset timeout"`
+	// NonIdempotent allows retries of POST and PATCH calls, the handler may get such a call twice
+	NonIdempotent bool `json:"non_idempotent,omitempty"`
+}
+
+// Timeouts of calls to the handler in milliseconds, the ones left zero are taken from the handler and then from
+// the registry defaults
+type Timeouts struct {
+	// ConnectMs limits establishing a new connection to an instance
+	ConnectMs int `json:"connect_ms,omitempty" validate:"min=0"`
+	// FirstByteMs limits the wait for the response headers from the start of an attempt
+	FirstByteMs int `json:"first_byte_ms,omitempty" validate:"min=0"`
+	// TotalMs limits the whole call including the retries and reading the response body
+	TotalMs int `json:"total_ms,omitempty" validate:"min=0"`
+}
+
+// Instance is one of the upstream sockets serving the handler
+type Instance struct {
+	Socket string `json:"socket" validate:"required,url"`
+	// Weight defaults to 1 when omitted
+	Weight int `json:"weight,omitempty" validate:"min=0"`
 }
 
 type Specification struct {
-	Socket  string   `json:"socket" validate:"required,url"`
-	Methods []Method `json:"methods" validate:"required"`
+	// Name is an optional unique slug which can be used instead of the handler ID
+	Name        string   `json:"name,omitempty" validate:"omitempty,max=64"`
+	Description string   `json:"description,omitempty" validate:"max=1024"`
+	Owner       string   `json:"owner,omitempty" validate:"max=256"`
+	Tags        []string `json:"tags,omitempty" validate:"omitempty,dive,required,max=64"`
+	// Socket is the primary instance, it is always a part of Instances
+	Socket    string     `json:"socket" validate:"required,url"`
+	Instances []Instance `json:"instances,omitempty" validate:"omitempty,dive"`
+	// Balancing is the strategy used to pick an instance per call, round robin is used by default
+	Balancing string `json:"balancing,omitempty" validate:"omitempty,oneof=round_robin least_in_flight weighted_random"`
+	// HealthPath is probed by the background health checks, without it any HTTP answer means the instance is alive
+	HealthPath string `json:"health_path,omitempty" validate:"omitempty,startswith=/"`
+	// LeaseTTL enables the lease mode: the handler must send heartbeats at least once per LeaseTTL seconds
+	LeaseTTL int `json:"lease_ttl,omitempty" validate:"min=0"`
+	// ResponseValidation tells how responses violating the method response schemas are treated, off by default
+	ResponseValidation string `json:"response_validation,omitempty" validate:"omitempty,oneof=off log reject"`
+	// ForwardClaims names the claims of the caller token which are passed to the handler in signed headers
+	ForwardClaims []string `json:"forward_claims,omitempty" validate:"omitempty,dive,required,max=64"`
+	// RateLimits apply to all calls of the handler
+	RateLimits *RateLimits `json:"rate_limits,omitempty"`
+	// RetryPolicy applies to the methods without their own one, calls are not retried without it
+	RetryPolicy *RetryPolicy `json:"retry_policy,omitempty"`
+	// Timeouts apply to the methods which don't set their own ones
+	Timeouts *Timeouts `json:"timeouts,omitempty"`
+	Methods  []Method  `json:"methods" validate:"required,dive"`
+}
+
+// HandlerStatus is the registry state of the handler which is not a part of its specification
+type HandlerStatus struct {
+	// State is one of the lifecycle states, only active handlers are proxied to
+	State          string     `json:"state"`
+	LeaseExpiresAt *time.Time `json:"lease_expires_at,omitempty"`
+}
+
+type RevisionInfo struct {
+	Revision int    `json:"revision"`
+	Author   string `json:"author"`
+	// RolledBackFrom is set when the revision was created by rolling back to an earlier one
+	RolledBackFrom *int      `json:"rolled_back_from,omitempty"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+type Revision struct {
+	RevisionInfo
+	Specification Specification `json:"specification"`
 }
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// aggregatedDocumentMaxAge bounds staleness of the merged document when the registry is changed by another replica
+// and the change notifications are not available
+const aggregatedDocumentMaxAge = 30 * time.Second
+
+const useEndpointNote = "Methods are called through POST /handlers/use with handler_id, path and method form values, " +
+	"paths below are prefixed with the handler name or id."
+
+// documentVersionLength is the number of hex digits of the specifications hash used as the document version
+const documentVersionLength = 16
+
+// OpenAPIAggregator builds OpenAPI 3 documents describing methods of the registered handlers.
+// The merged document is cached and rebuilt on the first request after the registry changes. Versions of
+// the documents are hashes of the specifications they describe, so every replica gives the same document
+// the same version.
+type OpenAPIAggregator struct {
+	logger   common.Logger
+	repo     specificationsProvider
+	mu       sync.Mutex
+	document []byte
+	version  string
+	builtAt  time.Time
+}
+
+func NewOpenAPIAggregator(logger common.Logger, repo specificationsProvider) *OpenAPIAggregator {
+	return &OpenAPIAggregator{
+		logger: logger,
+		repo:   repo,
+	}
+}
+
+func (aggregator *OpenAPIAggregator) RegistryChanged(string) {
+	aggregator.mu.Lock()
+	defer aggregator.mu.Unlock()
+
+	aggregator.document = nil
+}
+
+// Document returns the merged document of all registered handlers which are not retired along with its version,
+// each handler is namespaced by its name or id
+func (aggregator *OpenAPIAggregator) Document() ([]byte, string, *http_tools.Error) {
+	aggregator.mu.Lock()
+	defer aggregator.mu.Unlock()
+
+	if aggregator.document != nil && time.Since(aggregator.builtAt) < aggregatedDocumentMaxAge {
+		return aggregator.document, aggregator.version, nil
+	}
+
+	specs, httpErr := aggregator.repo.GetAllSpecifications()
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+	version, httpErr := aggregator.documentVersion(specs)
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	handlerIDs := make([]string, 0, len(specs))
+	for handlerID := range specs {
+		handlerIDs = append(handlerIDs, handlerID)
+	}
+	sort.Strings(handlerIDs)
+
+	doc := newOpenAPIDocument("Registered handlers", useEndpointNote, version)
+	tags := make([]map[string]any, 0, len(specs))
+	for _, handlerID := range handlerIDs {
+		spec := specs[handlerID]
+		namespace := handlerID
+		if spec.Name != "" {
+			namespace = spec.Name
+		}
+
+		addMethodsToDocument(doc, handlerID, namespace, spec)
+		tags = append(tags, map[string]any{"name": namespace, "description": spec.Description})
+	}
+	doc["tags"] = tags
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		aggregator.logger.Error(err)
+		return nil, "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	aggregator.document = document
+	aggregator.version = version
+	aggregator.builtAt = time.Now()
+
+	return document, version, nil
+}
+
+// HandlerDocument returns the document of a single handler with its paths as the handler serves them
+// along with its version
+func (aggregator *OpenAPIAggregator) HandlerDocument(handlerID string, spec Specification) ([]byte, string,
+	*http_tools.Error) {
+	title := spec.Name
+	if title == "" {
+		title = handlerID
+	}
+
+	version, httpErr := aggregator.documentVersion(map[string]Specification{handlerID: spec})
+	if httpErr != nil {
+		return nil, "", httpErr
+	}
+
+	doc := newOpenAPIDocument(title, spec.Description, version)
+	addMethodsToDocument(doc, handlerID, "", spec)
+
+	document, err := json.Marshal(doc)
+	if err != nil {
+		aggregator.logger.Error(err)
+		return nil, "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	return document, version, nil
+}
+
+// documentVersion hashes the specifications keyed by handler ID, JSON objects are marshalled with sorted keys,
+// so the same specifications always have the same version
+func (aggregator *OpenAPIAggregator) documentVersion(specs map[string]Specification) (string, *http_tools.Error) {
+	encoded, err := json.Marshal(specs)
+	if err != nil {
+		aggregator.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	sum := sha256.Sum256(encoded)
+	return hex.EncodeToString(sum[:])[:documentVersionLength], nil
+}
+
+func newOpenAPIDocument(title, description, version string) map[string]any {
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       title,
+			"description": description,
+			"version":     version,
+		},
+		"paths": make(map[string]map[string]any),
+	}
+}
+
+func addMethodsToDocument(doc map[string]any, handlerID, namespace string, spec Specification) {
+	paths := doc["paths"].(map[string]map[string]any)
+
+	for _, method := range spec.Methods {
+		template, err := ParsePathTemplate(method.PathPart)
+		if err != nil {
+			continue
+		}
+
+		path, pathParams := template.openAPIPath()
+		if namespace != "" {
+			path = "/" + namespace + path
+		}
+
+		operation := map[string]any{
+			"summary":      method.Summary,
+			"x-handler-id": handlerID,
+			"responses":    map[string]any{"default": map[string]any{"description": "Handler response"}},
+		}
+		if namespace != "" {
+			operation["tags"] = []string{namespace}
+		}
+
+		parameters := pathParams
+		for key, value := range method.Metadata {
+			switch key {
+			case OperationIDMetadata:
+				var operationID string
+				if json.Unmarshal(value, &operationID) == nil && namespace != "" {
+					operationID = namespace + "." + operationID
+				}
+				operation["operationId"] = operationID
+			case DescriptionMetadata:
+				operation["description"] = value
+			case RequestBodyMetadata:
+				operation["requestBody"] = value
+			case ResponsesMetadata:
+				operation["responses"] = value
+			case ParametersMetadata:
+				parameters = mergeParameters(pathParams, value)
+			}
+		}
+		operation["parameters"] = parameters
+
+		if paths[path] == nil {
+			paths[path] = make(map[string]any)
+		}
+		paths[path][strings.ToLower(method.MethodType)] = operation
+	}
+}
+
+// mergeParameters adds the documented parameters which are not path parameters of the template,
+// the template is authoritative for path parameters
+func mergeParameters(pathParams []map[string]any, documented json.RawMessage) []map[string]any {
+	var params []map[string]any
+	if err := json.Unmarshal(documented, &params); err != nil {
+		return pathParams
+	}
+
+	merged := append(make([]map[string]any, 0, len(pathParams)+len(params)), pathParams...)
+	for _, param := range params {
+		if param["in"] != "path" {
+			merged = append(merged, param)
+		}
+	}
+
+	return merged
+}
+
+// openAPIPath converts the template into an OpenAPI path and describes its parameters
+func (template PathTemplate) openAPIPath() (string, []map[string]any) {
+	parts := make([]string, 0, len(template.segments))
+	params := make([]map[string]any, 0)
+
+	for _, segment := range template.segments {
+		if segment.kind == literalSegment {
+			parts = append(parts, segment.value)
+			continue
+		}
+
+		parts = append(parts, "{"+segment.value+"}")
+
+		schema := map[string]any{"type": "string"}
+		switch segment.paramType {
+		case intParam:
+			schema = map[string]any{"type": "integer", "minimum": 0}
+		case uuidParam:
+			schema["format"] = "uuid"
+		}
+
+		param := map[string]any{"name": segment.value, "in": "path", "required": true, "schema": schema}
+		if segment.kind == wildcardSegment {
+			param["description"] = "Matches the rest of the path including slashes"
+		}
+		params = append(params, param)
+	}
+
+	return "/" + strings.Join(parts, "/"), params
+}
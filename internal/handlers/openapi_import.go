@@ -0,0 +1,306 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"sort"
+	"strings"
+)
+
+// Keys of Method.Metadata filled from OpenAPI operations
+const (
+	OperationIDMetadata = "operation_id"
+	DescriptionMetadata = "description"
+	ParametersMetadata  = "parameters"
+	RequestBodyMetadata = "request_body"
+	ResponsesMetadata   = "responses"
+)
+
+var openAPIVerbs = []string{"get", "put", "post", "delete", "options", "head", "patch", "trace"}
+
+const (
+	// maxRefDepth bounds the chain of $refs resolved one inside another
+	maxRefDepth = 64
+	// maxResolvedNodes bounds the size of the document once its $refs are inlined, a shared schema is copied
+	// to every place it is referenced from
+	maxResolvedNodes = 100000
+)
+
+type openAPIDocument struct {
+	OpenAPI string `json:"openapi"`
+	Info    struct {
+		Title       string `json:"title"`
+		Description string `json:"description"`
+	} `json:"info"`
+	Paths map[string]map[string]json.RawMessage `json:"paths"`
+}
+
+type openAPIOperation struct {
+	OperationID string            `json:"operationId"`
+	Summary     string            `json:"summary"`
+	Description string            `json:"description"`
+	Parameters  []json.RawMessage `json:"parameters"`
+	RequestBody json.RawMessage   `json:"requestBody"`
+	Responses   json.RawMessage   `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name   string `json:"name"`
+	In     string `json:"in"`
+	Schema struct {
+		Type   string `json:"type"`
+		Format string `json:"format"`
+	} `json:"schema"`
+}
+
+// MethodsFromOpenAPI derives specification methods from the paths of an OpenAPI 3 document given as JSON or YAML.
+// Path parameters declared as integers or uuids become typed template segments, summaries and schemas
+// are kept in the method metadata with all local $refs resolved, recursive schemas are cut where they refer
+// to themselves.
+func MethodsFromOpenAPI(document []byte) ([]Method, string, error) {
+	var root any
+	if err := json.Unmarshal(document, &root); err != nil {
+		var yamlRoot any
+		if yamlErr := yaml.Unmarshal(document, &yamlRoot); yamlErr != nil {
+			return nil, "", fmt.Errorf("document is neither JSON nor YAML: %w", yamlErr)
+		}
+		root = normalizeYAML(yamlRoot)
+	}
+
+	resolver := &refResolver{root: root, resolving: make(map[string]bool)}
+	inlined, err := resolver.resolve(root)
+	if err != nil {
+		return nil, "", err
+	}
+	resolved, err := json.Marshal(inlined)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var doc openAPIDocument
+	if err = json.Unmarshal(resolved, &doc); err != nil {
+		return nil, "", fmt.Errorf("malformed OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") {
+		return nil, "", errors.New("only OpenAPI 3 documents are supported")
+	}
+	if len(doc.Paths) == 0 {
+		return nil, "", errors.New("document has no paths")
+	}
+
+	paths := make([]string, 0, len(doc.Paths))
+	for path := range doc.Paths {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	methods := make([]Method, 0)
+	for _, path := range paths {
+		pathItem := doc.Paths[path]
+
+		var pathParams []json.RawMessage
+		if raw, ok := pathItem["parameters"]; ok {
+			if err = json.Unmarshal(raw, &pathParams); err != nil {
+				return nil, "", fmt.Errorf("malformed parameters of path %s: %w", path, err)
+			}
+		}
+
+		for _, verb := range openAPIVerbs {
+			raw, ok := pathItem[verb]
+			if !ok {
+				continue
+			}
+
+			var operation openAPIOperation
+			if err = json.Unmarshal(raw, &operation); err != nil {
+				return nil, "", fmt.Errorf("malformed operation %s %s: %w", verb, path, err)
+			}
+
+			method, err := methodFromOperation(path, verb, operation, pathParams)
+			if err != nil {
+				return nil, "", err
+			}
+			methods = append(methods, method)
+		}
+	}
+
+	description := doc.Info.Description
+	if description == "" {
+		description = doc.Info.Title
+	}
+
+	return methods, description, nil
+}
+
+func methodFromOperation(path, verb string, operation openAPIOperation, pathParams []json.RawMessage) (Method, error) {
+	params := make([]openAPIParameter, 0, len(pathParams)+len(operation.Parameters))
+	for _, raw := range append(append([]json.RawMessage{}, pathParams...), operation.Parameters...) {
+		var param openAPIParameter
+		if err := json.Unmarshal(raw, &param); err != nil {
+			return Method{}, fmt.Errorf("malformed parameter of %s %s: %w", verb, path, err)
+		}
+		params = append(params, param)
+	}
+
+	method := Method{
+		PathPart:   typedPathTemplate(path, params),
+		MethodType: strings.ToUpper(verb),
+		Summary:    operation.Summary,
+		Metadata:   make(map[string]json.RawMessage),
+	}
+
+	if operation.OperationID != "" {
+		method.Metadata[OperationIDMetadata], _ = json.Marshal(operation.OperationID)
+	}
+	if operation.Description != "" {
+		method.Metadata[DescriptionMetadata], _ = json.Marshal(operation.Description)
+	}
+	if len(operation.Parameters) > 0 {
+		rawParams, err := json.Marshal(operation.Parameters)
+		if err != nil {
+			return Method{}, err
+		}
+		method.Metadata[ParametersMetadata] = rawParams
+	}
+	if len(operation.RequestBody) > 0 {
+		method.Metadata[RequestBodyMetadata] = operation.RequestBody
+	}
+	if len(operation.Responses) > 0 {
+		method.Metadata[ResponsesMetadata] = operation.Responses
+	}
+
+	return method, nil
+}
+
+// typedPathTemplate turns {id} segments into {id:int} or {id:uuid} when the parameter schema allows it
+func typedPathTemplate(path string, params []openAPIParameter) string {
+	types := make(map[string]string)
+	for _, param := range params {
+		if param.In != "path" {
+			continue
+		}
+		switch {
+		case param.Schema.Type == "integer":
+			types[param.Name] = intParam
+		case param.Schema.Type == "string" && param.Schema.Format == "uuid":
+			types[param.Name] = uuidParam
+		}
+	}
+
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		if !strings.HasPrefix(segment, "{") || !strings.HasSuffix(segment, "}") {
+			continue
+		}
+		if paramType, ok := types[segment[1:len(segment)-1]]; ok {
+			segments[i] = "{" + segment[1:len(segment)-1] + ":" + paramType + "}"
+		}
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// refResolver replaces local {"$ref": "#/..."} objects with the referenced nodes
+type refResolver struct {
+	root any
+	// resolving holds the $refs on the way from the root to the current node
+	resolving map[string]bool
+	nodes     int
+}
+
+// resolve copies the node with its $refs inlined. Methods are stored without the components of the document,
+// so a $ref to a node already being resolved is replaced with a schema accepting any value.
+func (resolver *refResolver) resolve(node any) (any, error) {
+	resolver.nodes++
+	if resolver.nodes > maxResolvedNodes {
+		return nil, fmt.Errorf("document has more than %d nodes once its $refs are resolved", maxResolvedNodes)
+	}
+
+	switch value := node.(type) {
+	case map[string]any:
+		if ref, ok := value["$ref"].(string); ok {
+			if resolver.resolving[ref] {
+				return map[string]any{"description": "recursive reference to " + ref}, nil
+			}
+			target, ok := lookupPointer(resolver.root, ref)
+			if !ok {
+				return value, nil
+			}
+			if len(resolver.resolving) >= maxRefDepth {
+				return nil, fmt.Errorf("$refs of the document are nested deeper than %d levels", maxRefDepth)
+			}
+
+			resolver.resolving[ref] = true
+			defer delete(resolver.resolving, ref)
+			return resolver.resolve(target)
+		}
+
+		resolved := make(map[string]any, len(value))
+		for key, child := range value {
+			resolvedChild, err := resolver.resolve(child)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = resolvedChild
+		}
+		return resolved, nil
+	case []any:
+		resolved := make([]any, len(value))
+		for i, child := range value {
+			resolvedChild, err := resolver.resolve(child)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = resolvedChild
+		}
+		return resolved, nil
+	default:
+		return node, nil
+	}
+}
+
+func lookupPointer(root any, ref string) (any, bool) {
+	if !strings.HasPrefix(ref, "#/") {
+		return nil, false
+	}
+
+	node := root
+	for _, token := range strings.Split(ref[2:], "/") {
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = object[token]; !ok {
+			return nil, false
+		}
+	}
+
+	return node, true
+}
+
+// normalizeYAML converts YAML mappings with non-string keys, like response codes, into JSON-compatible maps
+func normalizeYAML(node any) any {
+	switch value := node.(type) {
+	case map[string]any:
+		for key, child := range value {
+			value[key] = normalizeYAML(child)
+		}
+		return value
+	case map[any]any:
+		converted := make(map[string]any, len(value))
+		for key, child := range value {
+			converted[fmt.Sprint(key)] = normalizeYAML(child)
+		}
+		return converted
+	case []any:
+		for i, child := range value {
+			value[i] = normalizeYAML(child)
+		}
+		return value
+	default:
+		return node
+	}
+}
@@ -0,0 +1,259 @@
+package handlers
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Path templates are written as ordinary paths where some segments are replaced with parameters:
+//
+//	/courses/{course_id}/grades      - any single non-empty segment
+//	/courses/{course_id:int}/grades  - typed segment, supported types are string, int and uuid
+//	/files/{file_path...}            - trailing wildcard, matches one or more remaining segments
+const (
+	stringParam = "string"
+	intParam    = "int"
+	uuidParam   = "uuid"
+)
+
+type pathSegmentKind int
+
+const (
+	literalSegment pathSegmentKind = iota
+	paramSegment
+	wildcardSegment
+)
+
+var (
+	paramNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+	intRegexp       = regexp.MustCompile(`^[0-9]+$`)
+	uuidRegexp      = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+)
+
+var paramSamples = map[string]string{
+	stringParam: "sample",
+	intParam:    "1",
+	uuidParam:   "00000000-0000-0000-0000-000000000000",
+}
+
+type pathSegment struct {
+	kind      pathSegmentKind
+	value     string
+	paramType string
+}
+
+type PathTemplate struct {
+	raw      string
+	segments []pathSegment
+}
+
+func ParsePathTemplate(raw string) (PathTemplate, error) {
+	template := PathTemplate{raw: raw}
+	names := make(map[string]bool)
+
+	parts := strings.Split(strings.TrimPrefix(raw, "/"), "/")
+	for i, part := range parts {
+		if !strings.HasPrefix(part, "{") && !strings.HasSuffix(part, "}") {
+			if strings.ContainsAny(part, "{}") {
+				return PathTemplate{}, fmt.Errorf("segment %q of path %q has unbalanced braces", part, raw)
+			}
+			template.segments = append(template.segments, pathSegment{kind: literalSegment, value: part})
+			continue
+		}
+
+		if !strings.HasPrefix(part, "{") || !strings.HasSuffix(part, "}") {
+			return PathTemplate{}, fmt.Errorf("segment %q of path %q has unbalanced braces", part, raw)
+		}
+
+		segment, err := parseParamSegment(part[1 : len(part)-1])
+		if err != nil {
+			return PathTemplate{}, fmt.Errorf("segment %q of path %q: %w", part, raw, err)
+		}
+		if segment.kind == wildcardSegment && i != len(parts)-1 {
+			return PathTemplate{}, fmt.Errorf("wildcard %q must be the last segment of path %q", part, raw)
+		}
+		if names[segment.value] {
+			return PathTemplate{}, fmt.Errorf("parameter %q is declared twice in path %q", segment.value, raw)
+		}
+		names[segment.value] = true
+
+		template.segments = append(template.segments, segment)
+	}
+
+	return template, nil
+}
+
+func parseParamSegment(body string) (pathSegment, error) {
+	if strings.HasSuffix(body, "...") {
+		name := strings.TrimSuffix(body, "...")
+		if !paramNameRegexp.MatchString(name) {
+			return pathSegment{}, fmt.Errorf("invalid parameter name %q", name)
+		}
+		return pathSegment{kind: wildcardSegment, value: name, paramType: stringParam}, nil
+	}
+
+	name, paramType, found := strings.Cut(body, ":")
+	if !found {
+		paramType = stringParam
+	}
+	if !paramNameRegexp.MatchString(name) {
+		return pathSegment{}, fmt.Errorf("invalid parameter name %q", name)
+	}
+	if _, ok := paramSamples[paramType]; !ok {
+		return pathSegment{}, fmt.Errorf("unknown parameter type %q", paramType)
+	}
+
+	return pathSegment{kind: paramSegment, value: name, paramType: paramType}, nil
+}
+
+func (template PathTemplate) String() string {
+	return template.raw
+}
+
+// Match checks whether the concrete path fits the template and returns values of the template parameters.
+// Parameters never match dot segments or encoded separators, so a path can't leave the prefix of the template
+// once the handler resolves it.
+func (template PathTemplate) Match(path string) (map[string]string, bool) {
+	parts := strings.Split(strings.TrimPrefix(path, "/"), "/")
+	params := make(map[string]string)
+
+	for i, segment := range template.segments {
+		if segment.kind == wildcardSegment {
+			if i >= len(parts) || strings.Join(parts[i:], "/") == "" {
+				return nil, false
+			}
+			for _, part := range parts[i:] {
+				if !isPlainSegment(part) {
+					return nil, false
+				}
+			}
+			params[segment.value] = strings.Join(parts[i:], "/")
+			return params, true
+		}
+
+		if i >= len(parts) {
+			return nil, false
+		}
+
+		switch segment.kind {
+		case literalSegment:
+			if parts[i] != segment.value {
+				return nil, false
+			}
+		case paramSegment:
+			if !paramAccepts(segment.paramType, parts[i]) {
+				return nil, false
+			}
+			params[segment.value] = parts[i]
+		}
+	}
+
+	if len(parts) != len(template.segments) {
+		return nil, false
+	}
+
+	return params, true
+}
+
+// Overlaps reports whether there is at least one concrete path matched by both templates
+func (template PathTemplate) Overlaps(other PathTemplate) bool {
+	for i := 0; ; i++ {
+		aDone, bDone := i >= len(template.segments), i >= len(other.segments)
+		if aDone || bDone {
+			return aDone && bDone
+		}
+
+		a, b := template.segments[i], other.segments[i]
+		if a.kind == wildcardSegment || b.kind == wildcardSegment {
+			return true
+		}
+		if !segmentsOverlap(a, b) {
+			return false
+		}
+	}
+}
+
+// Sample builds a concrete path matched by the template, it is used to probe handlers
+func (template PathTemplate) Sample() string {
+	parts := make([]string, 0, len(template.segments))
+	for _, segment := range template.segments {
+		if segment.kind == literalSegment {
+			parts = append(parts, segment.value)
+			continue
+		}
+		parts = append(parts, paramSamples[segment.paramType])
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+// HasParams reports whether the template contains any parameters
+func (template PathTemplate) HasParams() bool {
+	for _, segment := range template.segments {
+		if segment.kind != literalSegment {
+			return true
+		}
+	}
+	return false
+}
+
+func segmentsOverlap(a, b pathSegment) bool {
+	switch {
+	case a.kind == literalSegment && b.kind == literalSegment:
+		return a.value == b.value
+	case a.kind == literalSegment:
+		return paramAccepts(b.paramType, a.value)
+	case b.kind == literalSegment:
+		return paramAccepts(a.paramType, b.value)
+	default:
+		// int values never contain dashes and uuid values always do
+		return a.paramType == b.paramType || a.paramType == stringParam || b.paramType == stringParam
+	}
+}
+
+func paramAccepts(paramType, value string) bool {
+	switch paramType {
+	case intParam:
+		return intRegexp.MatchString(value)
+	case uuidParam:
+		return uuidRegexp.MatchString(value)
+	default:
+		return value != "" && isPlainSegment(value)
+	}
+}
+
+// isPlainSegment tells whether the raw path segment stays a single segment once it is unescaped and resolved
+func isPlainSegment(segment string) bool {
+	unescaped, err := url.PathUnescape(segment)
+	if err != nil {
+		return false
+	}
+	return unescaped != "." && unescaped != ".." && !strings.ContainsAny(unescaped, `/\`)
+}
+
+// checkMethodTemplates parses every method path and rejects methods of the same type which could match the same path
+func checkMethodTemplates(methods []Method) error {
+	templates := make([]PathTemplate, len(methods))
+	for i, method := range methods {
+		template, err := ParsePathTemplate(method.PathPart)
+		if err != nil {
+			return err
+		}
+		templates[i] = template
+	}
+
+	for i := range methods {
+		for j := i + 1; j < len(methods); j++ {
+			if methods[i].MethodType != methods[j].MethodType {
+				continue
+			}
+			if templates[i].Overlaps(templates[j]) {
+				return fmt.Errorf("methods %s %s and %s %s can match the same path",
+					methods[i].MethodType, methods[i].PathPart, methods[j].MethodType, methods[j].PathPart)
+			}
+		}
+	}
+
+	return nil
+}
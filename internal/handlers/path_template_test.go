@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParsePathTemplate(t *testing.T) {
+	tests := []struct {
+		name    string
+		raw     string
+		wantErr bool
+	}{
+		{name: "literal", raw: "/courses/grades"},
+		{name: "typed parameters", raw: "/courses/{course_id:int}/students/{student_id:uuid}"},
+		{name: "trailing wildcard", raw: "/files/{file_path...}"},
+		{name: "unbalanced braces", raw: "/courses/{course_id", wantErr: true},
+		{name: "braces inside a literal", raw: "/courses/a{b}c", wantErr: true},
+		{name: "unknown type", raw: "/courses/{course_id:float}", wantErr: true},
+		{name: "invalid name", raw: "/courses/{1st}", wantErr: true},
+		{name: "duplicate name", raw: "/courses/{id}/students/{id}", wantErr: true},
+		{name: "wildcard in the middle", raw: "/files/{file_path...}/meta", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ParsePathTemplate(tt.raw)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ParsePathTemplate(%q) error = %v, wantErr %v", tt.raw, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPathTemplateMatch(t *testing.T) {
+	tests := []struct {
+		name       string
+		template   string
+		path       string
+		wantParams map[string]string
+		wantOK     bool
+	}{
+		{name: "literal", template: "/courses", path: "/courses", wantParams: map[string]string{}, wantOK: true},
+		{name: "literal mismatch", template: "/courses", path: "/grades"},
+		{name: "string parameter", template: "/courses/{course_id}/grades", path: "/courses/math/grades",
+			wantParams: map[string]string{"course_id": "math"}, wantOK: true},
+		{name: "empty parameter", template: "/courses/{course_id}/grades", path: "/courses//grades"},
+		{name: "int parameter", template: "/courses/{course_id:int}", path: "/courses/42",
+			wantParams: map[string]string{"course_id": "42"}, wantOK: true},
+		{name: "int parameter mismatch", template: "/courses/{course_id:int}", path: "/courses/math"},
+		{name: "uuid parameter", template: "/students/{id:uuid}",
+			path:       "/students/6f1c2b7e-3d4a-4b5c-8d9e-0f1a2b3c4d5e",
+			wantParams: map[string]string{"id": "6f1c2b7e-3d4a-4b5c-8d9e-0f1a2b3c4d5e"}, wantOK: true},
+		{name: "uuid parameter mismatch", template: "/students/{id:uuid}", path: "/students/42"},
+		{name: "too many segments", template: "/courses/{course_id}", path: "/courses/math/grades"},
+		{name: "too few segments", template: "/courses/{course_id}/grades", path: "/courses/math"},
+		{name: "wildcard", template: "/files/{file_path...}", path: "/files/docs/a.txt",
+			wantParams: map[string]string{"file_path": "docs/a.txt"}, wantOK: true},
+		{name: "empty wildcard", template: "/files/{file_path...}", path: "/files/"},
+		{name: "missing wildcard", template: "/files/{file_path...}", path: "/files"},
+		{name: "dot dot parameter", template: "/courses/{course_id}/grades", path: "/courses/../grades"},
+		{name: "dot parameter", template: "/courses/{course_id}/grades", path: "/courses/./grades"},
+		{name: "encoded dot dot parameter", template: "/courses/{course_id}/grades", path: "/courses/%2e%2e/grades"},
+		{name: "encoded slash parameter", template: "/courses/{course_id}/grades", path: "/courses/a%2Fb/grades"},
+		{name: "encoded backslash parameter", template: "/courses/{course_id}/grades", path: "/courses/a%5Cb/grades"},
+		{name: "invalid escape parameter", template: "/courses/{course_id}/grades", path: "/courses/%zz/grades"},
+		{name: "dot dot in wildcard", template: "/files/{file_path...}", path: "/files/docs/../../admin"},
+		{name: "encoded dot dot in wildcard", template: "/files/{file_path...}", path: "/files/%2E%2E/admin"},
+		{name: "encoded slash in wildcard", template: "/files/{file_path...}", path: "/files/a%2f..%2fb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			template, err := ParsePathTemplate(tt.template)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q) error = %v", tt.template, err)
+			}
+
+			params, ok := template.Match(tt.path)
+			if ok != tt.wantOK {
+				t.Fatalf("Match(%q) ok = %v, want %v", tt.path, ok, tt.wantOK)
+			}
+			if ok && !reflect.DeepEqual(params, tt.wantParams) {
+				t.Errorf("Match(%q) params = %v, want %v", tt.path, params, tt.wantParams)
+			}
+		})
+	}
+}
+
+func TestPathTemplateOverlaps(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want bool
+	}{
+		{name: "same literals", a: "/courses", b: "/courses", want: true},
+		{name: "different literals", a: "/courses", b: "/grades"},
+		{name: "different lengths", a: "/courses/{id}", b: "/courses/{id}/grades"},
+		{name: "parameter and literal", a: "/courses/{id}", b: "/courses/math", want: true},
+		{name: "int parameter and word", a: "/courses/{id:int}", b: "/courses/math"},
+		{name: "int parameter and number", a: "/courses/{id:int}", b: "/courses/42", want: true},
+		{name: "int and uuid parameters", a: "/courses/{id:int}", b: "/courses/{id:uuid}"},
+		{name: "string and uuid parameters", a: "/courses/{id}", b: "/courses/{id:uuid}", want: true},
+		{name: "wildcard and longer path", a: "/files/{path...}", b: "/files/docs/{name}", want: true},
+		{name: "wildcard behind a different literal", a: "/files/{path...}", b: "/images/{name}"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := ParsePathTemplate(tt.a)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q) error = %v", tt.a, err)
+			}
+			b, err := ParsePathTemplate(tt.b)
+			if err != nil {
+				t.Fatalf("ParsePathTemplate(%q) error = %v", tt.b, err)
+			}
+
+			if got := a.Overlaps(b); got != tt.want {
+				t.Errorf("%q.Overlaps(%q) = %v, want %v", tt.a, tt.b, got, tt.want)
+			}
+			if got := b.Overlaps(a); got != tt.want {
+				t.Errorf("%q.Overlaps(%q) = %v, want %v", tt.b, tt.a, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckMethodTemplates(t *testing.T) {
+	tests := []struct {
+		name    string
+		methods []Method
+		wantErr bool
+	}{
+		{name: "distinct paths", methods: []Method{
+			{PathPart: "/courses/{id:int}", MethodType: "GET"},
+			{PathPart: "/courses/search", MethodType: "GET"},
+		}},
+		{name: "same path with different types", methods: []Method{
+			{PathPart: "/courses/{id}", MethodType: "GET"},
+			{PathPart: "/courses/{id}", MethodType: "DELETE"},
+		}},
+		{name: "overlapping paths of the same type", methods: []Method{
+			{PathPart: "/courses/{id}", MethodType: "GET"},
+			{PathPart: "/courses/search", MethodType: "GET"},
+		}, wantErr: true},
+		{name: "invalid template", methods: []Method{
+			{PathPart: "/courses/{id", MethodType: "GET"},
+		}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkMethodTemplates(tt.methods)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("checkMethodTemplates() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
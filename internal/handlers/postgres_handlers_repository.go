@@ -3,16 +3,37 @@ package handlers
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"github.com/educ-educ/handlers-service/internal/pkg/common"
 	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/postgres"
 	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// listSortExpressions maps HandlersFilter.SortBy values to SQL expressions, the handler id breaks ties
+var listSortExpressions = map[string]string{
+	SortByCreatedAt: "h.created_at",
+	SortByName:      "COALESCE(h.name, '')",
+	SortBySocket:    "h.socket_address",
+}
+
+// txTimeout bounds a whole unit of work, every query inside it still has its own timeout
+const txTimeout = 5 * time.Second
+
+// uniqueViolation is the SQLSTATE of an insert or update which breaks a unique index
+const uniqueViolation pq.ErrorCode = "23505"
+
 type PostgresHandlersRepository struct {
 	logger common.Logger
 	ctx    context.Context
-	db     *sql.DB
+	db     postgres.Executor
+	// pool is nil for repositories bound to a transaction
+	pool *sql.DB
 }
 
 func NewPostgresHandlersRepository(logger common.Logger, ctx context.Context, db *sql.DB) *PostgresHandlersRepository {
@@ -20,14 +41,53 @@ func NewPostgresHandlersRepository(logger common.Logger, ctx context.Context, db
 		logger: logger,
 		ctx:    ctx,
 		db:     db,
+		pool:   db,
+	}
+}
+
+// RunInTx calls fn with a repository bound to a single transaction, which is committed if fn succeeds
+// and rolled back otherwise. Calling it on a repository which is already bound to a transaction joins it.
+func (repo *PostgresHandlersRepository) RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error {
+	if repo.pool == nil {
+		return fn(repo)
+	}
+
+	txCtx, txCancelFunc := context.WithTimeout(repo.ctx, txTimeout)
+	defer txCancelFunc()
+
+	tx, err := repo.pool.BeginTx(txCtx, nil)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	txRepo := &PostgresHandlersRepository{
+		logger: repo.logger,
+		ctx:    txCtx,
+		db:     tx,
+	}
+	if httpErr := fn(txRepo); httpErr != nil {
+		if err = tx.Rollback(); err != nil {
+			repo.logger.Error(err)
+		}
+		return httpErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
 	}
+
+	return nil
 }
 
 func (repo *PostgresHandlersRepository) GetUsedSockets() ([]string, *http_tools.Error) {
 	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
 	defer queryCancelFunc()
 
-	rows, err := repo.db.QueryContext(queryCtx, `SELECT socket_address FROM handlers`)
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT socket_address FROM handler_instances
+		WHERE handler_id IN (SELECT id FROM handlers WHERE state NOT IN ('pending', 'retired'))`)
 	if err != nil {
 		repo.logger.Error(err)
 		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
@@ -56,16 +116,43 @@ func (repo *PostgresHandlersRepository) GetSpecification(handlerID string) (Spec
 	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
 	defer queryCancelFunc()
 
-	var socketAddress string
+	var (
+		spec        Specification
+		name        sql.NullString
+		rateLimits  []byte
+		retryPolicy []byte
+		timeouts    []byte
+	)
 	err := repo.db.QueryRowContext(queryCtx,
-		`SELECT socket_address FROM handlers WHERE id = $1`, handlerID).Scan(&socketAddress)
+		`SELECT socket_address, name, description, owner, tags, balancing, health_path, lease_ttl, response_validation,
+		forward_claims, rate_limits, retry_policy, timeouts FROM handlers WHERE id = $1`, handlerID).
+		Scan(&spec.Socket, &name, &spec.Description, &spec.Owner, pq.Array(&spec.Tags), &spec.Balancing,
+			&spec.HealthPath, &spec.LeaseTTL, &spec.ResponseValidation, pq.Array(&spec.ForwardClaims), &rateLimits,
+			&retryPolicy, &timeouts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Specification{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
 	if err != nil {
 		repo.logger.Error(err)
 		return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
 	}
+	spec.Name = name.String
+	if spec.RateLimits, err = unmarshalRateLimits(rateLimits); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if spec.RetryPolicy, err = unmarshalRetryPolicy(retryPolicy); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if spec.Timeouts, err = unmarshalTimeouts(timeouts); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
 
 	rows, err := repo.db.QueryContext(queryCtx,
-		`SELECT path_part, method_type FROM methods WHERE handler_id = $1`, handlerID)
+		`SELECT path_part, method_type, summary, metadata, request_schema, response_schemas, access,
+		rate_limits, retry_policy, timeouts FROM methods WHERE handler_id = $1 ORDER BY id`, handlerID)
 	if err != nil {
 		repo.logger.Error(err)
 		return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
@@ -77,34 +164,357 @@ func (repo *PostgresHandlersRepository) GetSpecification(handlerID string) (Spec
 	}()
 
 	methods := make([]Method, 0)
-	method := Method{}
 	for rows.Next() {
-		err = rows.Scan(&method.PathPart, &method.MethodType)
+		var (
+			method          Method
+			metadata        []byte
+			requestSchema   []byte
+			responseSchemas []byte
+			access          []byte
+			rateLimits      []byte
+			retryPolicy     []byte
+			timeouts        []byte
+		)
+		err = rows.Scan(&method.PathPart, &method.MethodType, &method.Summary, &metadata, &requestSchema,
+			&responseSchemas, &access, &rateLimits, &retryPolicy, &timeouts)
 		if err != nil {
 			repo.logger.Error(err)
 			return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
 		}
+		err = unmarshalMethodJSON(&method, metadata, requestSchema, responseSchemas, access, rateLimits, retryPolicy,
+			timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
 		methods = append(methods, method)
 	}
 
-	return Specification{
-		Socket:  socketAddress,
-		Methods: methods,
-	}, nil
+	spec.Methods = methods
+
+	instances, httpErr := repo.getInstances(queryCtx, handlerID)
+	if httpErr != nil {
+		return Specification{}, httpErr
+	}
+	spec.Instances = instances
+
+	return spec, nil
+}
+
+func (repo *PostgresHandlersRepository) getInstances(queryCtx context.Context, handlerID string) ([]Instance, *http_tools.Error) {
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT socket_address, weight FROM handler_instances WHERE handler_id = $1 ORDER BY id`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	instances := make([]Instance, 0)
+	instance := Instance{}
+	for rows.Next() {
+		err = rows.Scan(&instance.Socket, &instance.Weight)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// GetAllSpecifications returns specifications of every handler which is not retired keyed by handler ID
+func (repo *PostgresHandlersRepository) GetAllSpecifications() (map[string]Specification, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, 5*time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+		response_validation, forward_claims, rate_limits, retry_policy, timeouts FROM handlers WHERE state <> 'retired'`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	specs := make(map[string]Specification)
+	for rows.Next() {
+		var (
+			handlerID   string
+			spec        Specification
+			name        sql.NullString
+			rateLimits  []byte
+			retryPolicy []byte
+			timeouts    []byte
+		)
+		err = rows.Scan(&handlerID, &spec.Socket, &name, &spec.Description, &spec.Owner, pq.Array(&spec.Tags),
+			&spec.Balancing, &spec.HealthPath, &spec.LeaseTTL, &spec.ResponseValidation, pq.Array(&spec.ForwardClaims),
+			&rateLimits, &retryPolicy, &timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if spec.RateLimits, err = unmarshalRateLimits(rateLimits); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec.RetryPolicy, err = unmarshalRetryPolicy(retryPolicy); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec.Timeouts, err = unmarshalTimeouts(timeouts); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		spec.Name = name.String
+		spec.Methods = make([]Method, 0)
+		spec.Instances = make([]Instance, 0)
+		specs[handlerID] = spec
+	}
+
+	methodRows, err := repo.db.QueryContext(queryCtx,
+		`SELECT handler_id, path_part, method_type, summary, metadata, request_schema, response_schemas, access,
+		rate_limits, retry_policy, timeouts FROM methods ORDER BY id`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = methodRows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	for methodRows.Next() {
+		var (
+			handlerID       string
+			method          Method
+			metadata        []byte
+			requestSchema   []byte
+			responseSchemas []byte
+			access          []byte
+			rateLimits      []byte
+			retryPolicy     []byte
+			timeouts        []byte
+		)
+		err = methodRows.Scan(&handlerID, &method.PathPart, &method.MethodType, &method.Summary, &metadata,
+			&requestSchema, &responseSchemas, &access, &rateLimits, &retryPolicy, &timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		err = unmarshalMethodJSON(&method, metadata, requestSchema, responseSchemas, access, rateLimits, retryPolicy,
+			timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec, ok := specs[handlerID]; ok {
+			spec.Methods = append(spec.Methods, method)
+			specs[handlerID] = spec
+		}
+	}
+
+	instanceRows, err := repo.db.QueryContext(queryCtx,
+		`SELECT handler_id, socket_address, weight FROM handler_instances ORDER BY id`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = instanceRows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	for instanceRows.Next() {
+		var (
+			handlerID string
+			instance  Instance
+		)
+		err = instanceRows.Scan(&handlerID, &instance.Socket, &instance.Weight)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if spec, ok := specs[handlerID]; ok {
+			spec.Instances = append(spec.Instances, instance)
+			specs[handlerID] = spec
+		}
+	}
+
+	return specs, nil
+}
+
+// ListHandlers returns a page of handler summaries matching the filter and the cursor of the next page,
+// which is empty on the last page
+func (repo *PostgresHandlersRepository) ListHandlers(filter HandlersFilter) ([]HandlerSummary, string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, 2*time.Second)
+	defer queryCancelFunc()
+
+	if filter.SortBy == "" {
+		filter.SortBy = SortByCreatedAt
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+	sortExpression := listSortExpressions[filter.SortBy]
+
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+	arg := func(value any) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.SocketHost != "" {
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM handler_instances hi WHERE hi.handler_id = h.id
+			AND LOWER(SUBSTRING(hi.socket_address FROM '^[A-Za-z][A-Za-z0-9+.-]*://([^:/?#]+)')) = LOWER(`+
+			arg(filter.SocketHost)+`))`)
+	}
+	if filter.State != "" {
+		conditions = append(conditions, `h.state = `+arg(filter.State))
+	} else {
+		conditions = append(conditions, `h.state <> 'retired'`)
+	}
+	if filter.PathContains != "" || filter.MethodType != "" {
+		methodConditions := make([]string, 0, 2)
+		if filter.PathContains != "" {
+			methodConditions = append(methodConditions, `STRPOS(LOWER(m.path_part), LOWER(`+arg(filter.PathContains)+`)) > 0`)
+		}
+		if filter.MethodType != "" {
+			methodConditions = append(methodConditions, `UPPER(m.method_type) = UPPER(`+arg(filter.MethodType)+`)`)
+		}
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM methods m WHERE m.handler_id = h.id AND `+
+			strings.Join(methodConditions, " AND ")+`)`)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+		}
+
+		sortKey := arg(cursor.SortKey)
+		if filter.SortBy == SortByCreatedAt {
+			sortKey += "::timestamptz"
+		}
+		conditions = append(conditions, `(`+sortExpression+`, h.id) `+comparison+` (`+sortKey+`, `+arg(cursor.HandlerID)+`)`)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT h.id, h.name, h.description, h.owner, h.tags, h.socket_address, h.state, h.created_at,
+			(SELECT COUNT(*) FROM handler_instances hi WHERE hi.handler_id = h.id),
+			(SELECT COUNT(*) FROM methods m WHERE m.handler_id = h.id)
+		FROM handlers h `+where+`
+		ORDER BY `+sortExpression+` `+direction+`, h.id `+direction+`
+		LIMIT `+arg(filter.Limit+1), args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	summaries := make([]HandlerSummary, 0, filter.Limit)
+	for rows.Next() {
+		var (
+			summary HandlerSummary
+			name    sql.NullString
+		)
+		err = rows.Scan(&summary.HandlerID, &name, &summary.Description, &summary.Owner, pq.Array(&summary.Tags),
+			&summary.Socket, &summary.State, &summary.CreatedAt, &summary.InstancesCount, &summary.MethodsCount)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		summary.Name = name.String
+		summaries = append(summaries, summary)
+	}
+
+	nextCursor := ""
+	if len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+		last := summaries[len(summaries)-1]
+		nextCursor = encodeCursor(listCursor{SortKey: last.sortKey(filter.SortBy), HandlerID: last.HandlerID})
+	}
+
+	return summaries, nextCursor, nil
 }
 
-func (repo *PostgresHandlersRepository) AddHandlerInstance(socket string) (string, *http_tools.Error) {
+func (repo *PostgresHandlersRepository) GetHandlerIDByName(name string) (string, *http_tools.Error) {
 	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
 	defer queryCancelFunc()
 
-	id := uuid.New().String()
-	_, err := repo.db.ExecContext(queryCtx,
-		`INSERT INTO handlers (id, socket_address) VALUES ($1, $2)`, id, socket)
+	var handlerID string
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT id FROM handlers WHERE name = $1 AND state <> 'retired'`, name).Scan(&handlerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given name is not found"}
+	}
 	if err != nil {
 		repo.logger.Error(err)
 		return "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
 	}
 
+	return handlerID, nil
+}
+
+func (repo *PostgresHandlersRepository) AddHandlerInstance(specification Specification) (string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rateLimits, err := marshalRateLimits(specification.RateLimits)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	retryPolicy, err := marshalRetryPolicy(specification.RetryPolicy)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	timeouts, err := marshalTimeouts(specification.Timeouts)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	id := uuid.New().String()
+	_, err = repo.db.ExecContext(queryCtx,
+		`INSERT INTO handlers (id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+		response_validation, forward_claims, rate_limits, retry_policy, timeouts, lease_expires_at, state)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)`,
+		id, specification.Socket, postgres.NewNullableString(specification.Name), specification.Description,
+		specification.Owner, pq.Array(nonNilTags(specification.Tags)), specification.Balancing, specification.HealthPath,
+		specification.LeaseTTL, specification.ResponseValidation, pq.Array(nonNilTags(specification.ForwardClaims)),
+		rateLimits, retryPolicy, timeouts, leaseExpiry(specification.LeaseTTL), initialState(specification))
+	if err != nil {
+		repo.logger.Error(err)
+		return "", postgresUniqueError(err)
+	}
+
 	return id, nil
 }
 
@@ -112,15 +522,123 @@ func (repo *PostgresHandlersRepository) AddMethods(handlerID string, methods []M
 	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
 	defer queryCancelFunc()
 
+	if len(methods) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(methods))
+	args := make([]any, 0, 9*len(methods))
 	for _, method := range methods {
-		_, err := repo.db.ExecContext(queryCtx,
-			`INSERT INTO methods (handler_id, path_part, method_type) VALUES ($1, $2, $3)`,
-			handlerID, method.PathPart, method.MethodType)
+		metadata, err := marshalJSONObject(method.Metadata)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		responseSchemas, err := marshalJSONObject(method.ResponseSchemas)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		access, err := marshalMethodAccess(method.Access)
 		if err != nil {
 			repo.logger.Error(err)
-			return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		rateLimits, err := marshalRateLimits(method.RateLimits)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		retryPolicy, err := marshalRetryPolicy(method.RetryPolicy)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		timeouts, err := marshalTimeouts(method.Timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+
+		values = append(values, valuesPlaceholder(len(args), 11))
+		args = append(args, handlerID, method.PathPart, method.MethodType, method.Summary, metadata,
+			nullableJSON(method.RequestSchema), responseSchemas, access, rateLimits, retryPolicy, timeouts)
+	}
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`INSERT INTO methods (handler_id, path_part, method_type, summary, metadata, request_schema, response_schemas,
+		access, rate_limits, retry_policy, timeouts) VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return nil
+}
+
+func (repo *PostgresHandlersRepository) AddInstances(handlerID string, instances []Instance) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	if len(instances) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(instances))
+	args := make([]any, 0, 3*len(instances))
+	for _, instance := range instances {
+		values = append(values, valuesPlaceholder(len(args), 3))
+		args = append(args, handlerID, instance.Socket, instance.Weight)
+	}
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`INSERT INTO handler_instances (handler_id, socket_address, weight) VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return postgresUniqueError(err)
+	}
+
+	return nil
+}
+
+// postgresUniqueError reports violations of the unique name and socket indexes like the service does, the service
+// checks names and sockets before the changes, so another handler has taken one of them concurrently
+func postgresUniqueError(err error) *http_tools.Error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == uniqueViolation {
+		switch pqErr.Constraint {
+		case "handlers_name_key":
+			return &http_tools.Error{Type: http_tools.AlreadyExist, Info: "name is already in use"}
+		case "handler_instances_socket_address_key":
+			return &http_tools.Error{Type: http_tools.ValidationError, Info: "socket is already in use"}
 		}
 	}
+	return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+}
+
+// valuesPlaceholder returns a row of a multi-row VALUES list, like "($4, $5, $6)" for offset 3 and count 3
+func valuesPlaceholder(offset, count int) string {
+	placeholders := make([]string, 0, count)
+	for i := 1; i <= count; i++ {
+		placeholders = append(placeholders, "$"+strconv.Itoa(offset+i))
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// SetHandlerState moves the handler to the lifecycle state, the transition is checked by the service
+func (repo *PostgresHandlersRepository) SetHandlerState(handlerID, state string) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	result, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET state = $1 WHERE id = $2`, state, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return postgresUniqueError(err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
 
 	return nil
 }
@@ -143,12 +661,34 @@ func (repo *PostgresHandlersRepository) UpdateHandler(handlerID string, specific
 	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
 	defer queryCancelFunc()
 
-	_, err := repo.db.ExecContext(queryCtx,
-		`UPDATE handlers SET socket_address = $1 WHERE id = $2`,
-		specification.Socket, handlerID)
+	rateLimits, err := marshalRateLimits(specification.RateLimits)
 	if err != nil {
 		repo.logger.Error(err)
-		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	retryPolicy, err := marshalRetryPolicy(specification.RetryPolicy)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	timeouts, err := marshalTimeouts(specification.Timeouts)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	_, err = repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET socket_address = $1, name = $2, description = $3, owner = $4, tags = $5, balancing = $6,
+		health_path = $7, lease_ttl = $8, response_validation = $9, forward_claims = $10, rate_limits = $11,
+		retry_policy = $12, timeouts = $13, lease_expires_at = $14 WHERE id = $15`,
+		specification.Socket, postgres.NewNullableString(specification.Name), specification.Description,
+		specification.Owner, pq.Array(nonNilTags(specification.Tags)), specification.Balancing,
+		specification.HealthPath, specification.LeaseTTL, specification.ResponseValidation,
+		pq.Array(nonNilTags(specification.ForwardClaims)), rateLimits, retryPolicy, timeouts,
+		leaseExpiry(specification.LeaseTTL), handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return postgresUniqueError(err)
 	}
 
 	_, err = repo.db.ExecContext(queryCtx,
@@ -158,7 +698,384 @@ func (repo *PostgresHandlersRepository) UpdateHandler(handlerID string, specific
 		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
 	}
 
+	_, err = repo.db.ExecContext(queryCtx,
+		`DELETE FROM handler_instances WHERE handler_id = $1`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
 	queryCancelFunc()
 
+	if httpErr := repo.AddInstances(handlerID, specification.Instances); httpErr != nil {
+		return httpErr
+	}
+
 	return repo.AddMethods(handlerID, specification.Methods)
 }
+
+// leaseExpiry returns the expiry of a lease starting now, handlers without a lease never expire
+func leaseExpiry(leaseTTL int) *time.Time {
+	if leaseTTL == 0 {
+		return nil
+	}
+	expiresAt := time.Now().Add(time.Duration(leaseTTL) * time.Second)
+	return &expiresAt
+}
+
+// marshalJSONObject encodes a map for a NOT NULL JSONB column, which lib/pq expects as a string
+func marshalJSONObject(object map[string]json.RawMessage) (string, error) {
+	if object == nil {
+		return "{}", nil
+	}
+	encoded, err := json.Marshal(object)
+	return string(encoded), err
+}
+
+// unmarshalMethodJSON decodes the JSONB columns of a method leaving the empty ones nil
+func unmarshalMethodJSON(method *Method, metadata, requestSchema, responseSchemas, access, rateLimits,
+	retryPolicy, timeouts []byte) error {
+	if err := json.Unmarshal(metadata, &method.Metadata); err != nil {
+		return err
+	}
+	if len(method.Metadata) == 0 {
+		method.Metadata = nil
+	}
+
+	if err := json.Unmarshal(responseSchemas, &method.ResponseSchemas); err != nil {
+		return err
+	}
+	if len(method.ResponseSchemas) == 0 {
+		method.ResponseSchemas = nil
+	}
+
+	if len(access) > 0 {
+		if err := json.Unmarshal(access, &method.Access); err != nil {
+			return err
+		}
+	}
+
+	var err error
+	if method.RateLimits, err = unmarshalRateLimits(rateLimits); err != nil {
+		return err
+	}
+	if method.RetryPolicy, err = unmarshalRetryPolicy(retryPolicy); err != nil {
+		return err
+	}
+	if method.Timeouts, err = unmarshalTimeouts(timeouts); err != nil {
+		return err
+	}
+
+	method.RequestSchema = requestSchema
+	return nil
+}
+
+// marshalMethodAccess encodes the access requirements for a nullable JSONB column, methods open to anyone have none
+func marshalMethodAccess(access *MethodAccess) (sql.NullString, error) {
+	if access == nil || len(access.Roles) == 0 && len(access.Scopes) == 0 {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(access)
+	return sql.NullString{String: string(encoded), Valid: true}, err
+}
+
+// marshalRateLimits encodes the rate limits for a nullable JSONB column
+func marshalRateLimits(limits *RateLimits) (sql.NullString, error) {
+	if limits == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(limits)
+	return sql.NullString{String: string(encoded), Valid: true}, err
+}
+
+func unmarshalRateLimits(encoded []byte) (*RateLimits, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	var limits RateLimits
+	if err := json.Unmarshal(encoded, &limits); err != nil {
+		return nil, err
+	}
+	return &limits, nil
+}
+
+// marshalRetryPolicy encodes the retry policy for a nullable JSONB column
+func marshalRetryPolicy(policy *RetryPolicy) (sql.NullString, error) {
+	if policy == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(policy)
+	return sql.NullString{String: string(encoded), Valid: true}, err
+}
+
+func unmarshalRetryPolicy(encoded []byte) (*RetryPolicy, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	var policy RetryPolicy
+	if err := json.Unmarshal(encoded, &policy); err != nil {
+		return nil, err
+	}
+	return &policy, nil
+}
+
+// marshalTimeouts encodes the timeouts for a nullable JSONB column
+func marshalTimeouts(timeouts *Timeouts) (sql.NullString, error) {
+	if timeouts == nil {
+		return sql.NullString{}, nil
+	}
+	encoded, err := json.Marshal(timeouts)
+	return sql.NullString{String: string(encoded), Valid: true}, err
+}
+
+func unmarshalTimeouts(encoded []byte) (*Timeouts, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	var timeouts Timeouts
+	if err := json.Unmarshal(encoded, &timeouts); err != nil {
+		return nil, err
+	}
+	return &timeouts, nil
+}
+
+// nullableJSON encodes an optional JSON value for a nullable JSONB column
+func nullableJSON(value json.RawMessage) sql.NullString {
+	if len(value) == 0 || string(value) == "null" {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(value), Valid: true}
+}
+
+// nonNilTags keeps the tags and forward_claims columns NOT NULL for specifications without them
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+func (repo *PostgresHandlersRepository) GetHandlerStatus(handlerID string) (HandlerStatus, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var (
+		status         HandlerStatus
+		leaseExpiresAt sql.NullTime
+	)
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT state, lease_expires_at FROM handlers WHERE id = $1`, handlerID).Scan(&status.State, &leaseExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return HandlerStatus{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return HandlerStatus{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if leaseExpiresAt.Valid {
+		status.LeaseExpiresAt = &leaseExpiresAt.Time
+	}
+
+	return status, nil
+}
+
+// RenewLease moves the lease expiry forward and activates the handler if it is pending
+func (repo *PostgresHandlersRepository) RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET lease_expires_at = $1,
+		state = CASE WHEN state = 'pending' THEN 'active' ELSE state END WHERE id = $2`, expiresAt, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return postgresUniqueError(err)
+	}
+
+	return nil
+}
+
+// DeactivateExpiredLeases moves active handlers whose lease lapsed before now back to pending and returns their IDs
+func (repo *PostgresHandlersRepository) DeactivateExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	return repo.queryIDs(
+		`UPDATE handlers SET state = 'pending' WHERE state = 'active' AND lease_expires_at < $1 RETURNING id`, now)
+}
+
+// RetireExpiredLeases retires handlers whose lease lapsed before now and returns their IDs
+func (repo *PostgresHandlersRepository) RetireExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	return repo.queryIDs(`UPDATE handlers SET state = 'retired' WHERE state <> 'retired' AND lease_expires_at < $1
+		RETURNING id`, now)
+}
+
+func (repo *PostgresHandlersRepository) queryIDs(query string, args ...any) ([]string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx, query, args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	ids := make([]string, 0)
+	id := ""
+	for rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (repo *PostgresHandlersRepository) AddRevision(handlerID string, specification Specification, author string,
+	rolledBackFrom *int) (int, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	specJSON, err := json.Marshal(specification)
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	// the handler row is locked till the end of the transaction, so concurrent changes of the handler
+	// do not compute the same next revision
+	var lockedID string
+	err = repo.db.QueryRowContext(queryCtx, `SELECT id FROM handlers WHERE id = $1 FOR UPDATE`, handlerID).
+		Scan(&lockedID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	var revision int
+	err = repo.db.QueryRowContext(queryCtx,
+		`INSERT INTO specification_revisions (handler_id, revision, specification, author, rolled_back_from)
+		SELECT $1, COALESCE(MAX(revision), 0) + 1, $2, $3, $4 FROM specification_revisions WHERE handler_id = $1
+		RETURNING revision`,
+		handlerID, string(specJSON), author, rolledBackFrom).Scan(&revision)
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return revision, nil
+}
+
+func (repo *PostgresHandlersRepository) GetRevisions(handlerID string) ([]RevisionInfo, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT revision, author, rolled_back_from, created_at FROM specification_revisions
+		WHERE handler_id = $1 ORDER BY revision`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	revisions := make([]RevisionInfo, 0)
+	for rows.Next() {
+		var (
+			revision       RevisionInfo
+			rolledBackFrom sql.NullInt32
+		)
+		err = rows.Scan(&revision.Revision, &revision.Author, &rolledBackFrom, &revision.CreatedAt)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if rolledBackFrom.Valid {
+			from := int(rolledBackFrom.Int32)
+			revision.RolledBackFrom = &from
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+func (repo *PostgresHandlersRepository) GetRevision(handlerID string, revisionNumber int) (Revision, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var (
+		revision       Revision
+		rolledBackFrom sql.NullInt32
+		specJSON       []byte
+	)
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT revision, author, rolled_back_from, created_at, specification FROM specification_revisions
+		WHERE handler_id = $1 AND revision = $2`, handlerID, revisionNumber).
+		Scan(&revision.Revision, &revision.Author, &rolledBackFrom, &revision.CreatedAt, &specJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, &http_tools.Error{Type: http_tools.NotFound, Info: "revision with given number is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return Revision{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if rolledBackFrom.Valid {
+		from := int(rolledBackFrom.Int32)
+		revision.RolledBackFrom = &from
+	}
+
+	if err = json.Unmarshal(specJSON, &revision.Specification); err != nil {
+		repo.logger.Error(err)
+		return Revision{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	return revision, nil
+}
+
+func (repo *PostgresHandlersRepository) GetOwnerKeyHash(handlerID string) (string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	hash := ""
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT COALESCE(owner_key_hash, '') FROM handlers WHERE id = $1`, handlerID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return hash, nil
+}
+
+func (repo *PostgresHandlersRepository) SetOwnerKeyHash(handlerID, hash string) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	result, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET owner_key_hash = $1 WHERE id = $2`, hash, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS methods;
+
+DROP TABLE IF EXISTS handlers;
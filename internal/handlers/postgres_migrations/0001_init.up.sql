@@ -1,3 +1,4 @@
+-- the schema of build/docker/db/init.sql, which databases created before the migrations already have
 CREATE TABLE IF NOT EXISTS handlers (
     id VARCHAR(128) PRIMARY KEY,
     socket_address TEXT UNIQUE
@@ -8,4 +9,4 @@ CREATE TABLE IF NOT EXISTS methods (
     handler_id VARCHAR(128) REFERENCES handlers (id) ON DELETE CASCADE NOT NULL,
     path_part TEXT,
     method_type TEXT
-);
\ No newline at end of file
+);
@@ -0,0 +1,28 @@
+DROP TABLE IF EXISTS specification_revisions;
+
+DROP TABLE IF EXISTS handler_instances;
+
+ALTER TABLE methods
+    DROP COLUMN response_schemas,
+    DROP COLUMN request_schema,
+    DROP COLUMN metadata,
+    DROP COLUMN summary;
+
+-- deactivated handlers may share sockets with other handlers, they are purged to restore the unique constraint
+DELETE FROM handlers WHERE NOT active AND socket_address IN (
+    SELECT socket_address FROM handlers GROUP BY socket_address HAVING COUNT(*) > 1
+);
+ALTER TABLE handlers ADD CONSTRAINT handlers_socket_address_key UNIQUE (socket_address);
+
+ALTER TABLE handlers
+    DROP COLUMN created_at,
+    DROP COLUMN active,
+    DROP COLUMN lease_expires_at,
+    DROP COLUMN response_validation,
+    DROP COLUMN lease_ttl,
+    DROP COLUMN health_path,
+    DROP COLUMN balancing,
+    DROP COLUMN tags,
+    DROP COLUMN owner,
+    DROP COLUMN description,
+    DROP COLUMN name;
@@ -0,0 +1,45 @@
+ALTER TABLE handlers
+    ADD COLUMN name VARCHAR(64) UNIQUE,
+    ADD COLUMN description TEXT NOT NULL DEFAULT '',
+    ADD COLUMN owner TEXT NOT NULL DEFAULT '',
+    ADD COLUMN tags TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN balancing TEXT NOT NULL DEFAULT 'round_robin',
+    ADD COLUMN health_path TEXT NOT NULL DEFAULT '',
+    ADD COLUMN lease_ttl INTEGER NOT NULL DEFAULT 0,
+    ADD COLUMN response_validation TEXT NOT NULL DEFAULT 'off',
+    ADD COLUMN lease_expires_at TIMESTAMPTZ,
+    ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE,
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+-- socket_address is the primary instance now, sockets are kept in handler_instances
+ALTER TABLE handlers DROP CONSTRAINT handlers_socket_address_key;
+
+ALTER TABLE methods
+    ADD COLUMN summary TEXT NOT NULL DEFAULT '',
+    ADD COLUMN metadata JSONB NOT NULL DEFAULT '{}',
+    ADD COLUMN request_schema JSONB,
+    ADD COLUMN response_schemas JSONB NOT NULL DEFAULT '{}';
+
+CREATE TABLE handler_instances (
+    id SERIAL PRIMARY KEY,
+    handler_id VARCHAR(128) REFERENCES handlers (id) ON DELETE CASCADE NOT NULL,
+    socket_address TEXT NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1
+);
+
+-- sockets of deactivated handlers may be reused, so uniqueness among active handlers is checked by the service
+CREATE INDEX handler_instances_socket_address_idx ON handler_instances (socket_address);
+
+-- handlers registered before instances existed are served by their only socket
+INSERT INTO handler_instances (handler_id, socket_address)
+SELECT id, socket_address FROM handlers WHERE socket_address IS NOT NULL;
+
+CREATE TABLE specification_revisions (
+    handler_id VARCHAR(128) REFERENCES handlers (id) ON DELETE CASCADE NOT NULL,
+    revision INTEGER NOT NULL,
+    specification JSONB NOT NULL,
+    author TEXT NOT NULL DEFAULT '',
+    rolled_back_from INTEGER,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    PRIMARY KEY (handler_id, revision)
+);
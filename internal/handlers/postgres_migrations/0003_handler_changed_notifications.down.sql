@@ -0,0 +1,4 @@
+DROP TRIGGER IF EXISTS handler_instances_changed ON handler_instances;
+DROP TRIGGER IF EXISTS methods_changed ON methods;
+DROP TRIGGER IF EXISTS handlers_changed ON handlers;
+DROP FUNCTION IF EXISTS notify_handler_changed();
@@ -0,0 +1,21 @@
+-- replicas cache specifications and drop a handler from the cache when its ID arrives on the handler_changed channel.
+-- Notifications are delivered on commit, and Postgres collapses duplicates sent within one transaction.
+CREATE OR REPLACE FUNCTION notify_handler_changed() RETURNS trigger AS $$
+BEGIN
+    IF TG_OP = 'DELETE' THEN
+        PERFORM pg_notify('handler_changed', to_jsonb(OLD) ->> TG_ARGV[0]);
+    ELSE
+        PERFORM pg_notify('handler_changed', to_jsonb(NEW) ->> TG_ARGV[0]);
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER handlers_changed AFTER INSERT OR UPDATE OR DELETE ON handlers
+    FOR EACH ROW EXECUTE FUNCTION notify_handler_changed('id');
+
+CREATE TRIGGER methods_changed AFTER INSERT OR UPDATE OR DELETE ON methods
+    FOR EACH ROW EXECUTE FUNCTION notify_handler_changed('handler_id');
+
+CREATE TRIGGER handler_instances_changed AFTER INSERT OR UPDATE OR DELETE ON handler_instances
+    FOR EACH ROW EXECUTE FUNCTION notify_handler_changed('handler_id');
@@ -0,0 +1,8 @@
+-- retired handlers may share names, they are purged to restore the unique constraint
+DELETE FROM handlers WHERE state = 'retired';
+DROP INDEX handlers_name_key;
+ALTER TABLE handlers ADD CONSTRAINT handlers_name_key UNIQUE (name);
+
+ALTER TABLE handlers ADD COLUMN active BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE handlers SET active = FALSE WHERE state = 'pending';
+ALTER TABLE handlers DROP COLUMN state;
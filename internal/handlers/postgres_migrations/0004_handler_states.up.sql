@@ -0,0 +1,8 @@
+-- the lifecycle state replaces the active flag, handlers deactivated because of an expired lease wait in pending
+ALTER TABLE handlers ADD COLUMN state TEXT NOT NULL DEFAULT 'active';
+UPDATE handlers SET state = 'pending' WHERE NOT active;
+ALTER TABLE handlers DROP COLUMN active;
+
+-- retired handlers keep their names in the history, so names are unique only among the other handlers
+ALTER TABLE handlers DROP CONSTRAINT handlers_name_key;
+CREATE UNIQUE INDEX handlers_name_key ON handlers (name) WHERE state <> 'retired';
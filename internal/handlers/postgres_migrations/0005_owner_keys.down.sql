@@ -0,0 +1 @@
+ALTER TABLE handlers DROP COLUMN owner_key_hash;
@@ -0,0 +1,2 @@
+-- roles and scopes required to call the method, see Method.Access
+ALTER TABLE methods ADD COLUMN access JSONB;
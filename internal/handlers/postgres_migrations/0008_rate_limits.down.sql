@@ -0,0 +1,4 @@
+DROP FUNCTION IF EXISTS take_rate_limit_token(TEXT, DOUBLE PRECISION, DOUBLE PRECISION);
+DROP TABLE IF EXISTS rate_limit_buckets;
+ALTER TABLE methods DROP COLUMN rate_limits;
+ALTER TABLE handlers DROP COLUMN rate_limits;
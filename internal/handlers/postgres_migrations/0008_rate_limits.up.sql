@@ -0,0 +1,43 @@
+-- rate limits of handlers and methods, see RateLimits
+ALTER TABLE handlers ADD COLUMN rate_limits JSONB;
+ALTER TABLE methods ADD COLUMN rate_limits JSONB;
+
+-- token buckets shared by replicas when RATE_LIMIT_STORE is postgres. A bucket is full again at full_at,
+-- so it can be dropped after that without changing any decision.
+CREATE TABLE IF NOT EXISTS rate_limit_buckets (
+    key TEXT PRIMARY KEY,
+    tokens DOUBLE PRECISION NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL,
+    full_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS rate_limit_buckets_full_at_idx ON rate_limit_buckets (full_at);
+
+-- take_rate_limit_token refills the bucket for the time passed since its last use and takes a token if there is one.
+-- The row lock serializes concurrent calls, the clock is read after it is taken so the refill is never negative.
+CREATE OR REPLACE FUNCTION take_rate_limit_token(bucket_key TEXT, burst DOUBLE PRECISION, rate DOUBLE PRECISION,
+    OUT allowed BOOLEAN, OUT tokens_left DOUBLE PRECISION) AS $$
+DECLARE
+    taken_at TIMESTAMPTZ;
+BEGIN
+    INSERT INTO rate_limit_buckets (key, tokens, updated_at, full_at)
+    VALUES (bucket_key, burst, clock_timestamp(), clock_timestamp())
+    ON CONFLICT (key) DO NOTHING;
+
+    PERFORM 1 FROM rate_limit_buckets WHERE key = bucket_key FOR UPDATE;
+    taken_at := clock_timestamp();
+
+    SELECT LEAST(burst, b.tokens + GREATEST(EXTRACT(EPOCH FROM taken_at - b.updated_at), 0) * rate)
+    INTO tokens_left FROM rate_limit_buckets b WHERE b.key = bucket_key;
+
+    allowed := tokens_left >= 1;
+    IF allowed THEN
+        tokens_left := tokens_left - 1;
+    END IF;
+
+    UPDATE rate_limit_buckets
+    SET tokens = tokens_left, updated_at = taken_at,
+        full_at = taken_at + make_interval(secs => (burst - tokens_left) / rate)
+    WHERE key = bucket_key;
+END;
+$$ LANGUAGE plpgsql;
@@ -0,0 +1,2 @@
+ALTER TABLE methods DROP COLUMN retry_policy;
+ALTER TABLE handlers DROP COLUMN retry_policy;
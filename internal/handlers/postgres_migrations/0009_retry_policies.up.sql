@@ -0,0 +1,3 @@
+-- retry policies of handlers and methods, see RetryPolicy
+ALTER TABLE handlers ADD COLUMN retry_policy JSONB;
+ALTER TABLE methods ADD COLUMN retry_policy JSONB;
@@ -0,0 +1,8 @@
+DROP TRIGGER IF EXISTS handlers_hold_sockets ON handlers;
+DROP FUNCTION IF EXISTS update_instances_hold_sockets();
+DROP TRIGGER IF EXISTS handler_instances_holds_socket ON handler_instances;
+DROP FUNCTION IF EXISTS set_instance_holds_socket();
+
+DROP INDEX handler_instances_socket_address_key;
+CREATE INDEX handler_instances_socket_address_idx ON handler_instances (socket_address);
+ALTER TABLE handler_instances DROP COLUMN holds_socket;
@@ -0,0 +1,44 @@
+-- sockets are unique among the handlers holding them, which are all but pending and retired ones. The state of
+-- the handler is copied to its instances by triggers, so a partial unique index can enforce it.
+ALTER TABLE handler_instances ADD COLUMN holds_socket BOOLEAN NOT NULL DEFAULT TRUE;
+UPDATE handler_instances hi SET holds_socket = h.state NOT IN ('pending', 'retired')
+FROM handlers h WHERE h.id = hi.handler_id;
+
+-- handlers registered before the index might share sockets, they are left to the operator to sort out
+DO $$
+DECLARE
+    conflicts TEXT;
+BEGIN
+    SELECT string_agg(socket_address || ' (handlers ' || handler_ids || ')', ', ') INTO conflicts FROM (
+        SELECT socket_address, string_agg(DISTINCT handler_id, ', ') AS handler_ids FROM handler_instances
+        WHERE holds_socket GROUP BY socket_address HAVING COUNT(*) > 1
+    ) duplicates;
+    IF conflicts IS NOT NULL THEN
+        RAISE EXCEPTION 'sockets are held by several handlers: %', conflicts
+            USING HINT = 'retire all but one handler per socket or remove the duplicate instances';
+    END IF;
+END;
+$$;
+
+DROP INDEX handler_instances_socket_address_idx;
+CREATE UNIQUE INDEX handler_instances_socket_address_key ON handler_instances (socket_address) WHERE holds_socket;
+
+CREATE OR REPLACE FUNCTION set_instance_holds_socket() RETURNS trigger AS $$
+BEGIN
+    NEW.holds_socket := (SELECT state NOT IN ('pending', 'retired') FROM handlers WHERE id = NEW.handler_id);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER handler_instances_holds_socket BEFORE INSERT OR UPDATE OF handler_id ON handler_instances
+    FOR EACH ROW EXECUTE FUNCTION set_instance_holds_socket();
+
+CREATE OR REPLACE FUNCTION update_instances_hold_sockets() RETURNS trigger AS $$
+BEGIN
+    UPDATE handler_instances SET holds_socket = NEW.state NOT IN ('pending', 'retired') WHERE handler_id = NEW.id;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER handlers_hold_sockets AFTER UPDATE OF state ON handlers
+    FOR EACH ROW WHEN (OLD.state IS DISTINCT FROM NEW.state) EXECUTE FUNCTION update_instances_hold_sockets();
@@ -0,0 +1,235 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// bucketsSweepInterval is how often buckets which are full again are dropped, a full bucket is the same
+// as a missing one
+const bucketsSweepInterval = time.Minute
+
+// Caller is who calls a handler through /handlers/use
+type Caller struct {
+	// Claims are nil for anonymous callers
+	Claims jwt.Claims
+	IP     string
+}
+
+// key tells callers apart for the per-caller limits, by the subject of the token or by IP for anonymous callers
+func (caller Caller) key() string {
+	if subject, ok := caller.Claims["sub"].(string); ok && subject != "" {
+		return "sub:" + subject
+	}
+	return "ip:" + caller.IP
+}
+
+type rateLimitDecision struct {
+	allowed bool
+	// tokens are left in the bucket after the call
+	tokens float64
+}
+
+type rateLimiter interface {
+	// take takes a token from the bucket with the key, the bucket is created full
+	take(key string, burst, rate float64) (rateLimitDecision, error)
+}
+
+// SetRateLimiter replaces the default LocalRateLimiter, which keeps the buckets of every replica separately
+func (service *Service) SetRateLimiter(limiter rateLimiter) {
+	service.rateLimiter = limiter
+}
+
+func (limit *RateLimit) burst() float64 {
+	if limit.Burst > 0 {
+		return float64(limit.Burst)
+	}
+	return math.Max(1, math.Ceil(limit.Rate))
+}
+
+// normalized drops empty rate limits, so they are stored and compared like absent ones
+func (limits *RateLimits) normalized() *RateLimits {
+	if limits == nil || limits.Total == nil && limits.PerCaller == nil {
+		return nil
+	}
+	return limits
+}
+
+// checkRateLimits takes a token from every bucket the call counts against, the most specific ones first.
+// Tokens taken before a bucket turns out to be empty are not returned, a throttled caller keeps paying for retries.
+func (service *Service) checkRateLimits(handlerID string, method Method, handlerLimits *RateLimits,
+	caller Caller) *http_tools.Error {
+	methodKey := "m:" + handlerID + ":" + method.MethodType + " " + method.PathPart
+	handlerKey := "h:" + handlerID
+	callerKey := ":c:" + caller.key()
+
+	type bucket struct {
+		key   string
+		limit *RateLimit
+	}
+	var buckets []bucket
+	if method.RateLimits != nil {
+		buckets = append(buckets, bucket{methodKey + callerKey, method.RateLimits.PerCaller})
+	}
+	if handlerLimits != nil {
+		buckets = append(buckets, bucket{handlerKey + callerKey, handlerLimits.PerCaller})
+	}
+	if method.RateLimits != nil {
+		buckets = append(buckets, bucket{methodKey, method.RateLimits.Total})
+	}
+	if handlerLimits != nil {
+		buckets = append(buckets, bucket{handlerKey, handlerLimits.Total})
+	}
+
+	for _, bucket := range buckets {
+		if bucket.limit == nil {
+			continue
+		}
+
+		decision, err := service.rateLimiter.take(bucket.key, bucket.limit.burst(), bucket.limit.Rate)
+		if err != nil {
+			// the limits are not worth failing the call for
+			service.logger.Error("rate limit of ", bucket.key, " is not checked: ", err)
+			continue
+		}
+		if !decision.allowed {
+			service.logger.Warn("call of handler ", handlerID, " is throttled: ", bucket.key)
+			return rateLimitedError(bucket.limit, decision)
+		}
+	}
+
+	return nil
+}
+
+// rateLimitedError tells the caller when to retry in the Retry-After header and describes the bucket in
+// the RateLimit-Limit, RateLimit-Remaining and RateLimit-Reset headers, the times are in whole seconds
+func rateLimitedError(limit *RateLimit, decision rateLimitDecision) *http_tools.Error {
+	burst := limit.burst()
+	retryAfter := math.Max(1, math.Ceil((1-decision.tokens)/limit.Rate))
+	reset := math.Ceil((burst - decision.tokens) / limit.Rate)
+
+	headers := http.Header{}
+	headers.Set("Retry-After", strconv.FormatFloat(retryAfter, 'f', 0, 64))
+	headers.Set("RateLimit-Limit", strconv.FormatFloat(burst, 'f', 0, 64))
+	headers.Set("RateLimit-Remaining", strconv.FormatFloat(math.Floor(decision.tokens), 'f', 0, 64))
+	headers.Set("RateLimit-Reset", strconv.FormatFloat(reset, 'f', 0, 64))
+
+	return &http_tools.Error{Type: http_tools.RateLimitedError, Headers: headers,
+		Info: "rate limit of " + strconv.FormatFloat(limit.Rate, 'f', -1, 64) + " calls per second is exceeded"}
+}
+
+type localBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	fullAt    time.Time
+}
+
+// LocalRateLimiter keeps token buckets in memory, every replica of the registry limits the calls it proxies
+// on its own
+type LocalRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*localBucket
+	sweptAt time.Time
+}
+
+func NewLocalRateLimiter() *LocalRateLimiter {
+	return &LocalRateLimiter{
+		buckets: make(map[string]*localBucket),
+		sweptAt: time.Now(),
+	}
+}
+
+func (limiter *LocalRateLimiter) take(key string, burst, rate float64) (rateLimitDecision, error) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(limiter.sweptAt) > bucketsSweepInterval {
+		for bucketKey, bucket := range limiter.buckets {
+			if now.After(bucket.fullAt) {
+				delete(limiter.buckets, bucketKey)
+			}
+		}
+		limiter.sweptAt = now
+	}
+
+	bucket, ok := limiter.buckets[key]
+	if !ok {
+		bucket = &localBucket{tokens: burst, updatedAt: now}
+		limiter.buckets[key] = bucket
+	}
+
+	elapsed := math.Max(now.Sub(bucket.updatedAt).Seconds(), 0)
+	bucket.tokens = math.Min(burst, bucket.tokens+elapsed*rate)
+	bucket.updatedAt = now
+
+	decision := rateLimitDecision{allowed: bucket.tokens >= 1}
+	if decision.allowed {
+		bucket.tokens--
+	}
+	decision.tokens = bucket.tokens
+	bucket.fullAt = now.Add(time.Duration((burst - bucket.tokens) / rate * float64(time.Second)))
+
+	return decision, nil
+}
+
+// PostgresRateLimiter keeps token buckets in the rate_limit_buckets table, so the limits hold for all replicas
+// sharing the database together
+type PostgresRateLimiter struct {
+	logger common.Logger
+	ctx    context.Context
+	db     *sql.DB
+}
+
+func NewPostgresRateLimiter(logger common.Logger, ctx context.Context, db *sql.DB) *PostgresRateLimiter {
+	return &PostgresRateLimiter{
+		logger: logger,
+		ctx:    ctx,
+		db:     db,
+	}
+}
+
+func (limiter *PostgresRateLimiter) take(key string, burst, rate float64) (rateLimitDecision, error) {
+	queryCtx, cancel := context.WithTimeout(limiter.ctx, time.Second)
+	defer cancel()
+
+	var decision rateLimitDecision
+	err := limiter.db.QueryRowContext(queryCtx,
+		`SELECT allowed, tokens_left FROM take_rate_limit_token($1, $2, $3)`, key, burst, rate).
+		Scan(&decision.allowed, &decision.tokens)
+	return decision, err
+}
+
+// Start drops the buckets which are full again until the context is cancelled
+func (limiter *PostgresRateLimiter) Start(ctx context.Context) {
+	go func() {
+		ticker := time.NewTicker(bucketsSweepInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				limiter.sweep()
+			}
+		}
+	}()
+}
+
+func (limiter *PostgresRateLimiter) sweep() {
+	queryCtx, cancel := context.WithTimeout(limiter.ctx, time.Second)
+	defer cancel()
+
+	if _, err := limiter.db.ExecContext(queryCtx, `DELETE FROM rate_limit_buckets WHERE full_at < NOW()`); err != nil {
+		limiter.logger.Error("rate limit buckets sweep failed: ", err)
+	}
+}
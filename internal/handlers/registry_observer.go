@@ -0,0 +1,14 @@
+package handlers
+
+// RegistryObserver is notified after a handler is registered, changed or removed
+type RegistryObserver interface {
+	RegistryChanged(handlerID string)
+}
+
+type registryObservers []RegistryObserver
+
+func (observers registryObservers) notify(handlerID string) {
+	for _, observer := range observers {
+		observer.RegistryChanged(handlerID)
+	}
+}
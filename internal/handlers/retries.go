@@ -0,0 +1,147 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryCountHeader tells the caller how many times the call was repeated before the response was received
+const RetryCountHeader = "X-Retry-Count"
+
+// Kinds of network errors a RetryPolicy can retry
+const (
+	// RetryOnConnect is a failure to connect, the handler has not received the call
+	RetryOnConnect = "connect"
+	// RetryOnReset is a connection closed by the handler before the response
+	RetryOnReset = "reset"
+	// RetryOnTimeout is a network timeout of a single attempt
+	RetryOnTimeout = "timeout"
+)
+
+const (
+	defaultBackoff    = 100 * time.Millisecond
+	defaultMaxBackoff = 2 * time.Second
+)
+
+var (
+	defaultRetryOnStatuses = []int{http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout}
+	defaultRetryOnErrors   = []string{RetryOnConnect, RetryOnReset}
+)
+
+// retryPolicy picks the policy of the method over the one of the handler
+func (method Method) retryPolicy(handlerPolicy *RetryPolicy) *RetryPolicy {
+	if method.RetryPolicy != nil {
+		return method.RetryPolicy
+	}
+	return handlerPolicy
+}
+
+// attempts is the number of attempts allowed for the HTTP method, calls which aren't idempotent are made once
+// unless the policy allows otherwise
+func (policy *RetryPolicy) attempts(methodType string) int {
+	if policy == nil || policy.MaxAttempts < 1 {
+		return 1
+	}
+	if !policy.NonIdempotent && !isIdempotent(methodType) {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+func isIdempotent(methodType string) bool {
+	switch methodType {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// backoff returns a random wait before the attempt, the attempts are numbered from 1
+func (policy *RetryPolicy) backoff(attempt int) time.Duration {
+	base, limit := defaultBackoff, defaultMaxBackoff
+	if policy.BackoffMs > 0 {
+		base = time.Duration(policy.BackoffMs) * time.Millisecond
+	}
+	if policy.MaxBackoffMs > 0 {
+		limit = time.Duration(policy.MaxBackoffMs) * time.Millisecond
+	}
+
+	ceiling := base
+	for i := 2; i < attempt && ceiling < limit; i++ {
+		ceiling *= 2
+	}
+	if ceiling > limit {
+		ceiling = limit
+	}
+
+	return time.Duration(rand.Int63n(int64(ceiling) + 1))
+}
+
+func (policy *RetryPolicy) retriesStatus(status int) bool {
+	statuses := policy.RetryOnStatuses
+	if len(statuses) == 0 {
+		statuses = defaultRetryOnStatuses
+	}
+	for _, retryable := range statuses {
+		if status == retryable {
+			return true
+		}
+	}
+	return false
+}
+
+func (policy *RetryPolicy) retriesError(err error) bool {
+	kinds := policy.RetryOnErrors
+	if len(kinds) == 0 {
+		kinds = defaultRetryOnErrors
+	}
+	return contains(kinds, networkErrorKind(err))
+}
+
+// networkErrorKind classifies the error of a call which got no response, it returns an empty string for
+// the errors which are never retried
+func networkErrorKind(err error) string {
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &opErr) && opErr.Op == "dial":
+		return RetryOnConnect
+	case errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled):
+		// the deadline is shared by all attempts, nothing is left for another one
+		return ""
+	case errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF):
+		return RetryOnReset
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return RetryOnTimeout
+	}
+	return ""
+}
+
+// retries tells whether the attempt failed in a way the policy retries
+func (policy *RetryPolicy) retries(result attemptResult) bool {
+	if result.resp != nil {
+		return policy.retriesStatus(result.resp.StatusCode)
+	}
+	return result.err != nil && policy.retriesError(result.err)
+}
+
+// beforeDeadline tells whether another attempt can be made after the wait
+func beforeDeadline(ctx context.Context, wait time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Until(deadline) > wait
+}
+
+// discard drops the response of an attempt which is going to be retried, reading the rest of a short body
+// lets the connection be reused
+func discard(resp *http.Response) {
+	_, _ = io.CopyN(io.Discard, resp.Body, 4096)
+	_ = resp.Body.Close()
+}
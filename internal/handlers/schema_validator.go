@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/santhosh-tekuri/jsonschema/v5"
+	"io"
+	"sync"
+)
+
+// DefaultSchemaCacheSize is how many compiled schemas are kept when the size is not configured
+const DefaultSchemaCacheSize = 1024
+
+// schemaURL is the name a schema is compiled under, it only shows up in error messages
+const schemaURL = "schema.json"
+
+var errExternalRefs = errors.New("schemas must not reference external documents")
+
+// SchemaViolation is a single mismatch between a JSON document and a schema
+type SchemaViolation struct {
+	// Location is a JSON pointer to the mismatched value, empty for the document root
+	Location string
+	Message  string
+}
+
+// SchemaValidator compiles JSON Schemas and keeps the recently used ones by the hash of their source,
+// the least recently used schema is evicted once size schemas are kept
+type SchemaValidator struct {
+	mu      sync.Mutex
+	size    int
+	recent  *list.List
+	schemas map[[sha256.Size]byte]*list.Element
+}
+
+type cachedSchema struct {
+	key      [sha256.Size]byte
+	compiled *jsonschema.Schema
+}
+
+func NewSchemaValidator(size int) *SchemaValidator {
+	if size <= 0 {
+		size = DefaultSchemaCacheSize
+	}
+	return &SchemaValidator{size: size, recent: list.New(), schemas: make(map[[sha256.Size]byte]*list.Element)}
+}
+
+// Check compiles the schema reporting why it is invalid, the compiled schema is not kept
+func (validator *SchemaValidator) Check(schema json.RawMessage) error {
+	_, err := compileSchema(schema)
+	return err
+}
+
+// Validate checks the JSON document against the schema, document must be valid JSON.
+// Empty document is validated as null.
+func (validator *SchemaValidator) Validate(schema json.RawMessage, document []byte) ([]SchemaViolation, error) {
+	compiled, err := validator.compile(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	var value any
+	if len(bytes.TrimSpace(document)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(document))
+		decoder.UseNumber()
+		if err = decoder.Decode(&value); err != nil {
+			return []SchemaViolation{{Message: "document is not valid JSON: " + err.Error()}}, nil
+		}
+		if decoder.More() {
+			return []SchemaViolation{{Message: "document is not valid JSON: unexpected data after the top-level value"}}, nil
+		}
+	}
+
+	err = compiled.Validate(value)
+	if err == nil {
+		return nil, nil
+	}
+
+	var validationErr *jsonschema.ValidationError
+	if !errors.As(err, &validationErr) {
+		return nil, err
+	}
+
+	return leafViolations(validationErr, make([]SchemaViolation, 0)), nil
+}
+
+func (validator *SchemaValidator) compile(schema json.RawMessage) (*jsonschema.Schema, error) {
+	key := sha256.Sum256(schema)
+	validator.mu.Lock()
+	if element, ok := validator.schemas[key]; ok {
+		validator.recent.MoveToFront(element)
+		validator.mu.Unlock()
+		return element.Value.(*cachedSchema).compiled, nil
+	}
+	validator.mu.Unlock()
+
+	compiled, err := compileSchema(schema)
+	if err != nil {
+		return nil, err
+	}
+
+	validator.mu.Lock()
+	defer validator.mu.Unlock()
+	if element, ok := validator.schemas[key]; ok {
+		validator.recent.MoveToFront(element)
+		return element.Value.(*cachedSchema).compiled, nil
+	}
+	validator.schemas[key] = validator.recent.PushFront(&cachedSchema{key: key, compiled: compiled})
+	if validator.recent.Len() > validator.size {
+		oldest := validator.recent.Back()
+		validator.recent.Remove(oldest)
+		delete(validator.schemas, oldest.Value.(*cachedSchema).key)
+	}
+
+	return compiled, nil
+}
+
+func compileSchema(schema json.RawMessage) (*jsonschema.Schema, error) {
+	compiler := jsonschema.NewCompiler()
+	compiler.LoadURL = func(string) (io.ReadCloser, error) {
+		return nil, errExternalRefs
+	}
+	if err := compiler.AddResource(schemaURL, bytes.NewReader(schema)); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	compiled, err := compiler.Compile(schemaURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return compiled, nil
+}
+
+// leafViolations flattens the error tree keeping only the most specific errors
+func leafViolations(err *jsonschema.ValidationError, violations []SchemaViolation) []SchemaViolation {
+	if len(err.Causes) == 0 {
+		return append(violations, SchemaViolation{Location: err.InstanceLocation, Message: err.Message})
+	}
+
+	for _, cause := range err.Causes {
+		violations = leafViolations(cause, violations)
+	}
+	return violations
+}
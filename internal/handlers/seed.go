@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+)
+
+// LoadSeedFile reads a JSON or YAML list of specifications to be registered on start
+func LoadSeedFile(path string) ([]Specification, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var specifications []Specification
+	if err = json.Unmarshal(content, &specifications); err == nil {
+		return specifications, nil
+	}
+
+	var root any
+	if yamlErr := yaml.Unmarshal(content, &root); yamlErr != nil {
+		return nil, fmt.Errorf("seed file is neither JSON nor YAML: %w", yamlErr)
+	}
+	normalized, err := json.Marshal(normalizeYAML(root))
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(normalized, &specifications); err != nil {
+		return nil, fmt.Errorf("seed file must be a list of specifications: %w", err)
+	}
+
+	return specifications, nil
+}
@@ -1,21 +1,68 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"github.com/educ-educ/handlers-service/internal/pkg/common"
 	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/jwt"
+	"github.com/google/uuid"
 	"io"
 	"net/http"
+	"net/http/httptrace"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
 	"time"
 )
 
+const pathParamHeaderPrefix = "X-Path-Param-"
+
+// seedAuthor is the author of revisions created from the seed file
+const seedAuthor = "seed"
+
+// Actions reported by Service.Upsert
+const (
+	UpsertCreated   = "created"
+	UpsertUpdated   = "updated"
+	UpsertUnchanged = "unchanged"
+)
+
+var handlerNameRegexp = regexp.MustCompile(`^[a-z0-9]+(?:[-_][a-z0-9]+)*$`)
+
 type handlersRepo interface {
 	GetUsedSockets() ([]string, *http_tools.Error)
 	GetSpecification(handlerID string) (Specification, *http_tools.Error)
-	AddHandlerInstance(socket string) (string, *http_tools.Error)
+	GetHandlerIDByName(name string) (string, *http_tools.Error)
+	ListHandlers(filter HandlersFilter) ([]HandlerSummary, string, *http_tools.Error)
+	GetHandlerStatus(handlerID string) (HandlerStatus, *http_tools.Error)
+	RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error
+	AddHandlerInstance(specification Specification) (string, *http_tools.Error)
 	AddMethods(handlerID string, methods []Method) *http_tools.Error
+	AddInstances(handlerID string, instances []Instance) *http_tools.Error
+	SetHandlerState(handlerID, state string) *http_tools.Error
 	RemoveHandler(handlerID string) *http_tools.Error
 	UpdateHandler(handlerID string, specification Specification) *http_tools.Error
+	AddRevision(handlerID string, specification Specification, author string, rolledBackFrom *int) (int, *http_tools.Error)
+	GetRevisions(handlerID string) ([]RevisionInfo, *http_tools.Error)
+	GetRevision(handlerID string, revision int) (Revision, *http_tools.Error)
+	// GetOwnerKeyHash returns an empty hash for handlers registered before owner keys existed
+	GetOwnerKeyHash(handlerID string) (string, *http_tools.Error)
+	SetOwnerKeyHash(handlerID, hash string) *http_tools.Error
+	// RunInTx makes the changes done through the repository passed to fn atomic
+	RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error
+}
+
+// Repository is the registry storage shared by the service and its background workers,
+// it is implemented by PostgresHandlersRepository, SQLiteHandlersRepository and MemoryHandlersRepository
+// and can be wrapped in CachingHandlersRepository
+type Repository interface {
+	handlersRepo
+	specificationsProvider
+	expiredLeasesRepo
 }
 
 type handlersValidator interface {
@@ -26,46 +73,194 @@ type Service struct {
 	logger            common.Logger
 	handlersRepo      handlersRepo
 	handlersValidator handlersValidator
+	balancer          *Balancer
+	schemaValidator   *SchemaValidator
+	violations        *contractViolations
+	observers         registryObservers
+	adminKeyHashes    []string
+	claimsSigningKey  []byte
+	accessClaims      AccessClaims
+	rateLimiter       rateLimiter
+	breakers          *circuitBreakers
+	defaultTimeouts   Timeouts
+	maxTimeout        time.Duration
+	maxValidatedBody  int64
 }
 
-func NewService(logger common.Logger, handlersRepo handlersRepo, handlersValidator handlersValidator) *Service {
+func NewService(logger common.Logger, handlersRepo handlersRepo, handlersValidator handlersValidator,
+	balancer *Balancer) *Service {
 	return &Service{
 		logger:            logger,
 		handlersRepo:      handlersRepo,
 		handlersValidator: handlersValidator,
+		balancer:          balancer,
+		schemaValidator:   NewSchemaValidator(DefaultSchemaCacheSize),
+		violations:        newContractViolations(),
+		accessClaims:      defaultAccessClaims,
+		rateLimiter:       NewLocalRateLimiter(),
+		breakers:          newCircuitBreakers(logger, DefaultBreakerConfig),
+		defaultTimeouts:   DefaultTimeouts,
+		maxTimeout:        DefaultMaxTimeout,
+		maxValidatedBody:  DefaultMaxValidatedBody,
+	}
+}
+
+// GetSpecification accepts either the handler ID or its name and returns the resolved ID along with the specification
+func (service *Service) GetSpecification(handlerRef string) (string, Specification, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return "", Specification{}, httpErr
+	}
+
+	spec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
+		return "", Specification{}, httpErr
 	}
+
+	return handlerID, spec, nil
+}
+
+// AddObserver subscribes the observer to changes made through the service
+func (service *Service) AddObserver(observer RegistryObserver) {
+	service.observers = append(service.observers, observer)
+}
+
+func (service *Service) GetStatus(handlerID string) (HandlerStatus, *http_tools.Error) {
+	return service.handlersRepo.GetHandlerStatus(handlerID)
+}
+
+func (service *Service) ListHandlers(filter HandlersFilter) ([]HandlerSummary, string, *http_tools.Error) {
+	return service.handlersRepo.ListHandlers(filter)
 }
 
-func (service *Service) GetSpecification(handlerID string) (Specification, *http_tools.Error) {
-	return service.handlersRepo.GetSpecification(handlerID)
+// Register returns the ID of the new handler and its owner key, which is required to change the handler later.
+// The key is shown only once, the registry keeps just its hash.
+func (service *Service) Register(specification Specification, author string) (string, string, *http_tools.Error) {
+	return service.register(specification, service.registrationAuthor("", author), true)
+}
+
+// Seed registers the specifications loaded on start. Reachability of the handlers is not checked,
+// as they are usually started after the registry. A registry which already has handlers is not seeded,
+// so restarts with a persistent backend don't try to register the same handlers again.
+func (service *Service) Seed(specifications []Specification) *http_tools.Error {
+	registered, _, httpErr := service.handlersRepo.ListHandlers(HandlersFilter{Limit: 1})
+	if httpErr != nil {
+		return httpErr
+	}
+	if len(registered) > 0 {
+		service.logger.Info("registry is not empty, seeding is skipped")
+		return nil
+	}
+
+	for _, specification := range specifications {
+		// seeded handlers are changed with admin keys, nobody could receive their owner keys
+		handlerID, _, httpErr := service.register(specification, seedAuthor, false)
+		if httpErr != nil {
+			return httpErr
+		}
+		service.logger.Info("seeded handler ", handlerID, " ", specification.Name)
+	}
+
+	return nil
 }
 
-func (service *Service) Register(specification Specification) (string, *http_tools.Error) {
-	isSocketUsed, httpErr := service.isSocketInUse(specification.Socket)
+func (service *Service) register(specification Specification, author string,
+	checkHandler bool) (string, string, *http_tools.Error) {
+	specification, httpErr := normalizeInstances(specification)
 	if httpErr != nil {
 		service.logger.Error(httpErr)
-		return "", httpErr
+		return "", "", httpErr
 	}
-	if isSocketUsed {
-		httpErr = &http_tools.Error{Type: http_tools.ValidationError, Info: "socket is already in use"}
+
+	if err := checkMethodTemplates(specification.Methods); err != nil {
+		httpErr := &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
 		service.logger.Error(httpErr)
-		return "", httpErr
+		return "", "", httpErr
 	}
 
-	if httpErr = service.handlersValidator.CheckHandler(specification); httpErr != nil {
-		return "", httpErr
+	if httpErr = service.checkMethodSchemas(specification.Methods); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	if httpErr = service.checkForwardClaims(specification.ForwardClaims); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	if httpErr = service.checkTimeouts(specification); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	if httpErr = service.checkHandlerName(specification.Name, ""); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
+	}
+
+	if httpErr = service.checkSocketsFree(specification.Instances, nil); httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", httpErr
 	}
 
-	handlerID, httpErr := service.handlersRepo.AddHandlerInstance(specification.Socket)
+	if checkHandler {
+		if httpErr = service.handlersValidator.CheckHandler(specification); httpErr != nil {
+			return "", "", httpErr
+		}
+	}
+
+	ownerKey, ownerKeyHash, httpErr := newOwnerKey()
 	if httpErr != nil {
-		return "", httpErr
+		service.logger.Error(httpErr)
+		return "", "", httpErr
 	}
 
-	if httpErr = service.handlersRepo.AddMethods(handlerID, specification.Methods); httpErr != nil {
-		return "", httpErr
+	var handlerID string
+	httpErr = service.handlersRepo.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		var httpErr *http_tools.Error
+		if handlerID, httpErr = repo.AddHandlerInstance(specification); httpErr != nil {
+			return httpErr
+		}
+
+		if httpErr = repo.AddInstances(handlerID, specification.Instances); httpErr != nil {
+			return httpErr
+		}
+
+		if httpErr = repo.AddMethods(handlerID, specification.Methods); httpErr != nil {
+			return httpErr
+		}
+
+		if _, httpErr = repo.AddRevision(handlerID, specification, author, nil); httpErr != nil {
+			return httpErr
+		}
+
+		return repo.SetOwnerKeyHash(handlerID, ownerKeyHash)
+	})
+	if httpErr != nil {
+		return "", "", httpErr
 	}
 
-	return handlerID, nil
+	service.observers.notify(handlerID)
+
+	return handlerID, ownerKey, nil
+}
+
+// SpecificationFromOpenAPI fills the methods of the base specification from the OpenAPI 3 document,
+// the document description is used when the base one is empty
+func (service *Service) SpecificationFromOpenAPI(document []byte, base Specification) (Specification, *http_tools.Error) {
+	methods, description, err := MethodsFromOpenAPI(document)
+	if err != nil {
+		httpErr := &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		service.logger.Error(httpErr)
+		return Specification{}, httpErr
+	}
+
+	base.Methods = methods
+	if base.Description == "" {
+		base.Description = description
+	}
+
+	return base, nil
 }
 
 func (service *Service) isSocketInUse(socket string) (bool, *http_tools.Error) {
@@ -77,6 +272,140 @@ func (service *Service) isSocketInUse(socket string) (bool, *http_tools.Error) {
 	return contains[string](usedSockets, socket), nil
 }
 
+// checkSocketsFree makes sure none of the instances is used by another handler, ownInstances are the ones
+// the handler already has and may keep. The repositories refuse taken sockets again when the instances are stored,
+// which catches concurrent changes.
+func (service *Service) checkSocketsFree(instances []Instance, ownInstances []Instance) *http_tools.Error {
+	for _, instance := range instances {
+		if containsSocket(ownInstances, instance.Socket) {
+			continue
+		}
+
+		isSocketUsed, httpErr := service.isSocketInUse(instance.Socket)
+		if httpErr != nil {
+			return httpErr
+		}
+		if isSocketUsed {
+			return &http_tools.Error{Type: http_tools.ValidationError, Info: "socket " + instance.Socket + " is already in use"}
+		}
+	}
+
+	return nil
+}
+
+// normalizeInstances fills in defaults and makes sure the primary socket is one of the instances
+func normalizeInstances(specification Specification) (Specification, *http_tools.Error) {
+	instances := make([]Instance, 0, len(specification.Instances)+1)
+	if !containsSocket(specification.Instances, specification.Socket) {
+		instances = append(instances, Instance{Socket: specification.Socket})
+	}
+	for _, instance := range specification.Instances {
+		if containsSocket(instances, instance.Socket) {
+			return Specification{}, &http_tools.Error{Type: http_tools.ValidationError,
+				Info: "socket " + instance.Socket + " is listed twice"}
+		}
+		instances = append(instances, instance)
+	}
+
+	for i := range instances {
+		if instances[i].Weight == 0 {
+			instances[i].Weight = 1
+		}
+	}
+	specification.Instances = instances
+
+	if specification.Balancing == "" {
+		specification.Balancing = RoundRobin
+	}
+	if specification.ResponseValidation == "" {
+		specification.ResponseValidation = ResponseValidationOff
+	}
+	specification.RateLimits = specification.RateLimits.normalized()
+	specification.Methods = normalizeMethodAccess(specification.Methods)
+	for i := range specification.Methods {
+		specification.Methods[i].RateLimits = specification.Methods[i].RateLimits.normalized()
+	}
+
+	return specification, nil
+}
+
+// checkMethodSchemas makes sure the request and response schemas of the methods compile
+func (service *Service) checkMethodSchemas(methods []Method) *http_tools.Error {
+	for _, method := range methods {
+		if len(method.RequestSchema) > 0 {
+			if err := service.schemaValidator.Check(method.RequestSchema); err != nil {
+				return &http_tools.Error{Type: http_tools.ValidationError,
+					Info: "request schema of " + method.MethodType + " " + method.PathPart + ": " + err.Error()}
+			}
+		}
+
+		for status, schema := range method.ResponseSchemas {
+			if !responseSchemaKeyRegexp.MatchString(status) {
+				return &http_tools.Error{Type: http_tools.ValidationError,
+					Info: "response schema of " + method.MethodType + " " + method.PathPart + " has invalid status " + status}
+			}
+			if err := service.schemaValidator.Check(schema); err != nil {
+				return &http_tools.Error{Type: http_tools.ValidationError,
+					Info: "response schema " + status + " of " + method.MethodType + " " + method.PathPart + ": " + err.Error()}
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsSocket(instances []Instance, socket string) bool {
+	for _, instance := range instances {
+		if instance.Socket == socket {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHandlerName validates the name format and makes sure no other handler than ownerID uses it
+func (service *Service) checkHandlerName(name, ownerID string) *http_tools.Error {
+	if name == "" {
+		return nil
+	}
+
+	if !handlerNameRegexp.MatchString(name) {
+		return &http_tools.Error{Type: http_tools.ValidationError,
+			Info: "name must consist of lowercase letters and digits separated by single dashes or underscores"}
+	}
+	if _, err := uuid.Parse(name); err == nil {
+		return &http_tools.Error{Type: http_tools.ValidationError, Info: "name must not look like a handler id"}
+	}
+
+	handlerID, httpErr := service.handlersRepo.GetHandlerIDByName(name)
+	if httpErr != nil {
+		if httpErr.Type == http_tools.NotFound {
+			return nil
+		}
+		return httpErr
+	}
+	if handlerID != ownerID {
+		return &http_tools.Error{Type: http_tools.AlreadyExist, Info: "name is already in use"}
+	}
+
+	return nil
+}
+
+// resolveHandlerID turns a handler reference, which is either a handler ID or a handler name, into the handler ID
+func (service *Service) resolveHandlerID(handlerRef string) (string, *http_tools.Error) {
+	if _, err := uuid.Parse(handlerRef); err == nil {
+		return handlerRef, nil
+	}
+
+	handlerID, httpErr := service.handlersRepo.GetHandlerIDByName(handlerRef)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", httpErr
+	}
+
+	return handlerID, nil
+}
+
 func contains[V comparable](arr []V, val V) bool {
 	for _, arrVal := range arr {
 		if val == arrVal {
@@ -86,76 +415,803 @@ func contains[V comparable](arr []V, val V) bool {
 	return false
 }
 
-func (service *Service) Unregister(handlerID string) *http_tools.Error {
-	return service.handlersRepo.RemoveHandler(handlerID)
-}
+// Unregister retires the handler, so its name and sockets are freed while the history is kept. A purge deletes
+// the handler with its history, retired handlers can be purged only by ID as their names may be reused.
+func (service *Service) Unregister(handlerRef string, purge bool, key string) *http_tools.Error {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return httpErr
+	}
 
-func (service *Service) Update(handlerID string, specification Specification) *http_tools.Error {
-	oldSpec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	httpErr = service.handlersRepo.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		if purge {
+			return repo.RemoveHandler(handlerID)
+		}
+		return repo.SetHandlerState(handlerID, StateRetired)
+	})
 	if httpErr != nil {
-		service.logger.Error(httpErr)
 		return httpErr
 	}
 
-	if oldSpec.Socket != specification.Socket {
-		var isSocketUsed bool
-		isSocketUsed, httpErr = service.isSocketInUse(specification.Socket)
+	service.observers.notify(handlerID)
+
+	return nil
+}
+
+// Transition moves the handler to the lifecycle state if stateTransitions allows it, and returns the number
+// of calls to the handler still in flight on this replica, which draining handlers wait for
+func (service *Service) Transition(handlerRef, state, key string) (string, int, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return "", 0, httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return "", 0, httpErr
+	}
+
+	var spec Specification
+	httpErr = service.handlersRepo.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		status, httpErr := repo.GetHandlerStatus(handlerID)
 		if httpErr != nil {
-			service.logger.Error(httpErr)
 			return httpErr
 		}
-		if isSocketUsed {
-			httpErr = &http_tools.Error{Type: http_tools.ValidationError, Info: "socket is already in use"}
-			service.logger.Error(httpErr)
+		if spec, httpErr = repo.GetSpecification(handlerID); httpErr != nil {
 			return httpErr
 		}
+		if status.State == state {
+			return nil
+		}
+		if !contains(stateTransitions[status.State], state) {
+			return &http_tools.Error{Type: http_tools.ForbiddenActionError,
+				Info: "handler can't be moved from " + status.State + " to " + state}
+		}
+		if state == StateActive && spec.LeaseTTL > 0 &&
+			(status.LeaseExpiresAt == nil || !status.LeaseExpiresAt.After(time.Now())) {
+			return &http_tools.Error{Type: http_tools.ForbiddenActionError,
+				Info: "handler in the lease mode must send a heartbeat before it is activated"}
+		}
+
+		return repo.SetHandlerState(handlerID, state)
+	})
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", 0, httpErr
+	}
+
+	service.observers.notify(handlerID)
+
+	return handlerID, service.balancer.InFlight(spec.Instances), nil
+}
+
+// checkNotRetired refuses changes of retired handlers, they are kept only for their history
+func (service *Service) checkNotRetired(handlerID string) *http_tools.Error {
+	status, httpErr := service.handlersRepo.GetHandlerStatus(handlerID)
+	if httpErr != nil {
+		return httpErr
+	}
+	if status.State == StateRetired {
+		return &http_tools.Error{Type: http_tools.ForbiddenActionError, Info: "handler is retired"}
+	}
+
+	return nil
+}
+
+func (service *Service) Update(handlerRef string, specification Specification, key string) *http_tools.Error {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return httpErr
+	}
+	author, httpErr := service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	_, httpErr = service.update(handlerID, specification, author, nil)
+	return httpErr
+}
+
+// Upsert registers the handler under the name of the specification or updates the handler already registered
+// under it, and tells which of the two happened. Sending the current specification again changes nothing,
+// so handlers may call it on every start. The owner key is returned only when the handler is created,
+// changing an existing handler requires its owner key.
+func (service *Service) Upsert(specification Specification, author, key string) (string, string, string,
+	*http_tools.Error) {
+	if specification.Name == "" {
+		httpErr := &http_tools.Error{Type: http_tools.ValidationError, Info: "name is required to upsert a handler"}
+		service.logger.Error(httpErr)
+		return "", "", "", httpErr
+	}
+
+	handlerID, httpErr := service.handlersRepo.GetHandlerIDByName(specification.Name)
+	if httpErr != nil && httpErr.Type != http_tools.NotFound {
+		service.logger.Error(httpErr)
+		return "", "", "", httpErr
+	}
+	if httpErr != nil {
+		var ownerKey string
+		handlerID, ownerKey, httpErr = service.register(specification, service.registrationAuthor(key, author), true)
+		if httpErr == nil {
+			return handlerID, UpsertCreated, ownerKey, nil
+		}
+		// another instance of the handler may have registered the name meanwhile
+		if httpErr.Type != http_tools.AlreadyExist {
+			return "", "", "", httpErr
+		}
+		if handlerID, httpErr = service.handlersRepo.GetHandlerIDByName(specification.Name); httpErr != nil {
+			service.logger.Error(httpErr)
+			return "", "", "", httpErr
+		}
+	}
+
+	author, httpErr = service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return "", "", "", httpErr
+	}
+
+	current, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", "", httpErr
+	}
+	normalized, httpErr := normalizeInstances(specification)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return "", "", "", httpErr
+	}
+	same, err := sameSpecification(current, normalized)
+	if err != nil {
+		httpErr = &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		service.logger.Error(httpErr)
+		return "", "", "", httpErr
+	}
+	if same {
+		return handlerID, UpsertUnchanged, "", nil
+	}
+
+	if _, httpErr = service.update(handlerID, specification, author, nil); httpErr != nil {
+		return "", "", "", httpErr
+	}
+
+	return handlerID, UpsertUpdated, "", nil
+}
+
+// sameSpecification compares the specifications by their JSON, so the formatting of schemas and metadata,
+// which the storage may change, doesn't matter
+func sameSpecification(a, b Specification) (bool, error) {
+	canonical := func(spec Specification) (any, error) {
+		encoded, err := json.Marshal(spec)
+		if err != nil {
+			return nil, err
+		}
+		var decoded any
+		err = json.Unmarshal(encoded, &decoded)
+		return decoded, err
+	}
+
+	canonicalA, err := canonical(a)
+	if err != nil {
+		return false, err
+	}
+	canonicalB, err := canonical(b)
+	if err != nil {
+		return false, err
+	}
+
+	return reflect.DeepEqual(canonicalA, canonicalB), nil
+}
+
+// update validates and stores the new specification of the handler and records it as a new revision
+func (service *Service) update(handlerID string, specification Specification, author string,
+	rolledBackFrom *int) (int, *http_tools.Error) {
+	if httpErr := service.checkNotRetired(handlerID); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	oldSpec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	specification, httpErr = normalizeInstances(specification)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if err := checkMethodTemplates(specification.Methods); err != nil {
+		httpErr = &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if httpErr = service.checkMethodSchemas(specification.Methods); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if httpErr = service.checkForwardClaims(specification.ForwardClaims); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if httpErr = service.checkTimeouts(specification); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if httpErr = service.checkHandlerName(specification.Name, handlerID); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	if httpErr = service.checkSocketsFree(specification.Instances, oldSpec.Instances); httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
 	}
 
 	if httpErr = service.handlersValidator.CheckHandler(specification); httpErr != nil {
 		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	var revision int
+	httpErr = service.handlersRepo.RunInTx(func(repo handlersRepo) *http_tools.Error {
+		httpErr := repo.UpdateHandler(handlerID, specification)
+		if httpErr != nil {
+			return httpErr
+		}
+
+		revision, httpErr = repo.AddRevision(handlerID, specification, author, rolledBackFrom)
+		return httpErr
+	})
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	service.observers.notify(handlerID)
+
+	return revision, nil
+}
+
+// AddInstance attaches one more upstream socket to the handler
+func (service *Service) AddInstance(handlerRef string, instance Instance, key string) *http_tools.Error {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return httpErr
+	}
+	author, httpErr := service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return httpErr
+	}
+
+	spec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
 		return httpErr
 	}
 
-	if httpErr = service.handlersRepo.UpdateHandler(handlerID, specification); httpErr != nil {
+	if containsSocket(spec.Instances, instance.Socket) {
+		httpErr = &http_tools.Error{Type: http_tools.AlreadyExist, Info: "instance is already attached to the handler"}
 		service.logger.Error(httpErr)
 		return httpErr
 	}
+	spec.Instances = append(spec.Instances, instance)
 
-	return nil
+	_, httpErr = service.update(handlerID, spec, author, nil)
+	return httpErr
 }
 
-func (service *Service) UseHandler(handlerID, path, method string, body io.Reader) (*http.Response, *http_tools.Error) {
+// RemoveInstance detaches the upstream socket from the handler. The last instance can't be removed,
+// if the primary socket is removed the next instance becomes primary.
+func (service *Service) RemoveInstance(handlerRef, socket, key string) *http_tools.Error {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return httpErr
+	}
+	author, httpErr := service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return httpErr
+	}
+
 	spec, httpErr := service.handlersRepo.GetSpecification(handlerID)
 	if httpErr != nil {
+		return httpErr
+	}
+
+	if !containsSocket(spec.Instances, socket) {
+		httpErr = &http_tools.Error{Type: http_tools.NotFound, Info: "instance with given socket is not found"}
+		service.logger.Error(httpErr)
+		return httpErr
+	}
+	if len(spec.Instances) == 1 {
+		httpErr = &http_tools.Error{Type: http_tools.ForbiddenActionError, Info: "the last instance of the handler can't be removed"}
 		service.logger.Error(httpErr)
+		return httpErr
+	}
+
+	instances := make([]Instance, 0, len(spec.Instances)-1)
+	for _, instance := range spec.Instances {
+		if instance.Socket != socket {
+			instances = append(instances, instance)
+		}
+	}
+	spec.Instances = instances
+	if spec.Socket == socket {
+		spec.Socket = instances[0].Socket
+	}
+
+	_, httpErr = service.update(handlerID, spec, author, nil)
+	return httpErr
+}
+
+// Heartbeat renews the lease of the handler and returns its new expiry. A pending handler is activated
+// if its sockets were not taken by another handler meanwhile, other states are kept.
+func (service *Service) Heartbeat(handlerRef, key string) (time.Time, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return time.Time{}, httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return time.Time{}, httpErr
+	}
+
+	spec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
+		return time.Time{}, httpErr
+	}
+	if spec.LeaseTTL == 0 {
+		httpErr = &http_tools.Error{Type: http_tools.ForbiddenActionError, Info: "handler is not registered in the lease mode"}
+		service.logger.Error(httpErr)
+		return time.Time{}, httpErr
+	}
+
+	status, httpErr := service.handlersRepo.GetHandlerStatus(handlerID)
+	if httpErr != nil {
+		return time.Time{}, httpErr
+	}
+	if status.State == StateRetired {
+		httpErr = &http_tools.Error{Type: http_tools.ForbiddenActionError, Info: "handler is retired"}
+		service.logger.Error(httpErr)
+		return time.Time{}, httpErr
+	}
+	if status.State == StatePending {
+		if httpErr = service.checkSocketsFree(spec.Instances, nil); httpErr != nil {
+			service.logger.Error(httpErr)
+			return time.Time{}, httpErr
+		}
+	}
+
+	expiresAt := time.Now().Add(time.Duration(spec.LeaseTTL) * time.Second)
+	if httpErr = service.handlersRepo.RenewLease(handlerID, expiresAt); httpErr != nil {
+		return time.Time{}, httpErr
+	}
+
+	if status.State == StatePending {
+		service.observers.notify(handlerID)
+	}
+
+	return expiresAt, nil
+}
+
+func (service *Service) ListRevisions(handlerRef string) ([]RevisionInfo, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
 		return nil, httpErr
 	}
 
-	targetMethod := Method{MethodType: method, PathPart: path}
-	if !contains[Method](spec.Methods, targetMethod) {
-		httpErr = &http_tools.Error{Type: http_tools.NotFound, Info: "endpoint with given params is not found"}
+	if _, httpErr = service.handlersRepo.GetSpecification(handlerID); httpErr != nil {
+		return nil, httpErr
+	}
+
+	return service.handlersRepo.GetRevisions(handlerID)
+}
+
+func (service *Service) GetRevision(handlerRef string, revision int) (Revision, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return Revision{}, httpErr
+	}
+
+	return service.handlersRepo.GetRevision(handlerID, revision)
+}
+
+// Rollback makes an earlier revision current again. The old specification is checked the same way as
+// an update, and the switch is recorded as a new revision, so the history itself is never rewritten.
+func (service *Service) Rollback(handlerRef string, revision int, key string) (int, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return 0, httpErr
+	}
+	author, httpErr := service.authenticate(handlerID, key)
+	if httpErr != nil {
+		return 0, httpErr
+	}
+
+	target, httpErr := service.handlersRepo.GetRevision(handlerID, revision)
+	if httpErr != nil {
 		service.logger.Error(httpErr)
+		return 0, httpErr
+	}
+
+	return service.update(handlerID, target.Specification, author, &target.Revision)
+}
+
+// UseHandler proxies the call to an instance of the handler, the claims are the verified claims of the caller token
+// or nil for anonymous calls
+func (service *Service) UseHandler(handlerRef, path, method string, body io.Reader,
+	caller Caller) (*http.Response, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
 		return nil, httpErr
 	}
 
-	fullURL := spec.Socket + path
+	spec, httpErr := service.handlersRepo.GetSpecification(handlerID)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return nil, httpErr
+	}
 
-	reqCtx, cancelCtx := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancelCtx()
+	status, httpErr := service.handlersRepo.GetHandlerStatus(handlerID)
+	if httpErr != nil {
+		service.logger.Error(httpErr)
+		return nil, httpErr
+	}
+	if httpErr = checkRoutable(status.State); httpErr != nil {
+		service.logger.Error(httpErr)
+		return nil, httpErr
+	}
 
-	req, err := http.NewRequestWithContext(reqCtx, method, fullURL, body)
-	if err != nil {
-		httpErr = &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
+	matched, pathParams, httpErr := service.matchMethod(spec, path, method)
+	if httpErr != nil {
 		service.logger.Error(httpErr)
 		return nil, httpErr
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		httpErr = &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
+	if httpErr = service.checkAccess(handlerID, matched, caller.Claims); httpErr != nil {
+		return nil, httpErr
+	}
+	if httpErr = service.checkRateLimits(handlerID, matched, spec.RateLimits, caller); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if len(matched.RequestSchema) > 0 {
+		if body, httpErr = service.validateRequestBody(matched, body); httpErr != nil {
+			service.logger.Error(httpErr)
+			return nil, httpErr
+		}
+	}
+
+	policy := matched.retryPolicy(spec.RetryPolicy)
+	attempts := policy.attempts(method)
+	// a body which may be sent again is read once and every attempt gets a copy of it
+	newBody := func() io.Reader { return body }
+	if attempts > 1 && body != nil {
+		payload, err := io.ReadAll(body)
+		if err != nil {
+			httpErr = &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+			service.logger.Error(httpErr)
+			return nil, httpErr
+		}
+		newBody = func() io.Reader { return bytes.NewReader(payload) }
+	}
+
+	// the total timeout covers all attempts, the context lives until the response body is closed,
+	// cancelling it earlier aborts reading the body
+	timeouts := resolveTimeouts(service.defaultTimeouts, spec.Timeouts, matched.Timeouts)
+	reqCtx, cancelCtx := context.WithTimeout(context.Background(), timeouts.total())
+
+	call := upstreamCall{handlerID: handlerID, spec: spec, method: method, path: path, pathParams: pathParams,
+		claims: caller.Claims, timeouts: timeouts}
+	var result attemptResult
+	retries := 0
+	for attempt := 1; ; attempt++ {
+		result = service.attempt(reqCtx, call, newBody())
+		if attempt >= attempts || !policy.retries(result) {
+			break
+		}
+		wait := policy.backoff(attempt + 1)
+		if !beforeDeadline(reqCtx, wait) {
+			break
+		}
+
+		if result.resp != nil {
+			service.logger.Warn("attempt ", attempt, " of handler ", handlerID, " call got status ",
+				result.resp.StatusCode, ", retrying in ", wait)
+			discard(result.resp)
+			result.release()
+		} else {
+			service.logger.Warn("attempt ", attempt, " of handler ", handlerID, " call failed: ", result.err,
+				", retrying in ", wait)
+		}
+		time.Sleep(wait)
+		retries++
+	}
+
+	if result.httpErr != nil {
+		cancelCtx()
+		httpErr = result.httpErr
+		if httpErr.Headers == nil {
+			httpErr.Headers = http.Header{}
+		}
+		httpErr.Headers.Set(RetryCountHeader, strconv.Itoa(retries))
 		service.logger.Error(httpErr)
 		return nil, httpErr
 	}
+	resp := result.resp
+	resp.Header.Set(RetryCountHeader, strconv.Itoa(retries))
+	resp.Body = &releasingBody{ReadCloser: resp.Body, release: result.release, cancel: cancelCtx}
+
+	if spec.ResponseValidation == ResponseValidationLog || spec.ResponseValidation == ResponseValidationReject {
+		if schema := matched.responseSchema(resp.StatusCode); schema != nil {
+			httpErr = service.validateResponseBody(handlerID, spec.ResponseValidation, matched, schema, resp)
+			if httpErr != nil {
+				service.logger.Error(httpErr)
+				return nil, httpErr
+			}
+		}
+	}
 
 	return resp, nil
 }
+
+// upstreamCall is a call of a handler method made through UseHandler
+type upstreamCall struct {
+	handlerID  string
+	spec       Specification
+	method     string
+	path       string
+	pathParams map[string]string
+	claims     jwt.Claims
+	timeouts   Timeouts
+}
+
+// attemptResult holds either a response along with the function releasing the instance once the response is
+// consumed, or an error. Err is the network error of a call which got no response.
+type attemptResult struct {
+	resp    *http.Response
+	release func()
+	err     error
+	httpErr *http_tools.Error
+}
+
+// attempt makes the call to one of the instances of the handler, the context is the one of the whole call
+func (service *Service) attempt(ctx context.Context, call upstreamCall, body io.Reader) attemptResult {
+	// instances known to be unhealthy or ejected by their breakers are skipped, if there are none left
+	// the call fails fast
+	var releaseInstance func()
+	admitted, httpErr := service.breakers.admit(call.handlerID, call.spec.Instances,
+		func(instances []Instance) (instance Instance, err error) {
+			instance, releaseInstance, err = service.balancer.Pick(call.spec.Balancing, instances)
+			return instance, err
+		})
+	if httpErr != nil {
+		return attemptResult{httpErr: httpErr}
+	}
+	instance := admitted.instance
+
+	// the attempt is cancelled with a timeoutError as the cause when the first byte is late
+	attemptCtx, cancelAttempt := context.WithCancelCause(withConnectTimeout(ctx, call.timeouts.connect()))
+	release := func() {
+		cancelAttempt(nil)
+		releaseInstance()
+	}
+	if firstByte := call.timeouts.firstByte(); firstByte > 0 {
+		timer := time.AfterFunc(firstByte, func() {
+			cancelAttempt(&timeoutError{name: "first byte", timeout: firstByte})
+		})
+		defer timer.Stop()
+		attemptCtx = httptrace.WithClientTrace(attemptCtx, &httptrace.ClientTrace{
+			GotFirstResponseByte: func() { timer.Stop() },
+		})
+	}
+
+	target, err := upstreamURL(instance.Socket, call.path)
+	if err != nil {
+		release()
+		admitted.cancel()
+		return attemptResult{httpErr: &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}}
+	}
+	req, err := http.NewRequestWithContext(attemptCtx, call.method, target, body)
+	if err != nil {
+		release()
+		admitted.cancel()
+		return attemptResult{httpErr: &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}}
+	}
+	for name, value := range call.pathParams {
+		req.Header.Set(pathParamHeaderPrefix+name, value)
+	}
+	service.forwardClaims(req, call.handlerID, call.path, call.spec.ForwardClaims, call.claims)
+
+	resp, err := upstreamClient.Do(req)
+	admitted.finish(err != nil || resp.StatusCode >= http.StatusInternalServerError)
+	if err != nil {
+		if cause := context.Cause(attemptCtx); cause != nil {
+			err = cause
+		}
+		release()
+		httpErr = upstreamTimeout(ctx, call.timeouts, err)
+		if httpErr == nil {
+			httpErr = &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
+		}
+		return attemptResult{err: err, httpErr: httpErr}
+	}
+
+	return attemptResult{resp: resp, release: release}
+}
+
+// upstreamURL appends the path of the call to the socket of the instance, the path is joined as a URL path,
+// so it can change neither the host nor the part of the path the socket starts with
+func upstreamURL(socket, path string) (string, error) {
+	base, err := url.Parse(socket)
+	if err != nil {
+		return "", err
+	}
+
+	path, query, _ := strings.Cut(path, "?")
+	target := base.JoinPath(path)
+	target.RawQuery = query
+	return target.String(), nil
+}
+
+// checkRoutable tells why calls to a handler in the state are refused, calls already in flight are not affected
+func checkRoutable(state string) *http_tools.Error {
+	switch state {
+	case StateActive:
+		return nil
+	case StatePending:
+		return &http_tools.Error{Type: http_tools.UnavailableError, Info: "handler is waiting for a heartbeat"}
+	case StateDraining:
+		return &http_tools.Error{Type: http_tools.UnavailableError, Info: "handler is draining"}
+	case StateDisabled:
+		return &http_tools.Error{Type: http_tools.ForbiddenActionError, Info: "handler is disabled"}
+	default:
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler is retired"}
+	}
+}
+
+// validateResponseBody buffers the response and checks it against the schema. Violations are logged and counted,
+// in the reject mode the response is replaced with an error. Bodies larger than maxValidatedBody are passed through
+// unchecked and counted as unvalidated.
+func (service *Service) validateResponseBody(handlerID, mode string, method Method, schema []byte,
+	resp *http.Response) *http_tools.Error {
+	payload, err := io.ReadAll(io.LimitReader(resp.Body, service.maxValidatedBody+1))
+	if err != nil {
+		if closeErr := resp.Body.Close(); closeErr != nil {
+			service.logger.Error(closeErr)
+		}
+		return &http_tools.Error{Type: http_tools.NetworkError, Info: err.Error()}
+	}
+	if int64(len(payload)) > service.maxValidatedBody {
+		service.violations.recordUnvalidated(handlerID, method)
+		service.logger.Warn("response of handler ", handlerID, " ", method.MethodType, " ", method.PathPart,
+			" is not validated: body is larger than ", service.maxValidatedBody, " bytes")
+		resp.Body = &prefixedBody{Reader: io.MultiReader(bytes.NewReader(payload), resp.Body), Closer: resp.Body}
+		return nil
+	}
+	if closeErr := resp.Body.Close(); closeErr != nil {
+		service.logger.Error(closeErr)
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(payload))
+
+	violations, err := service.schemaValidator.Validate(schema, payload)
+	if err != nil {
+		service.logger.Warn("response of handler ", handlerID, " ", method.MethodType, " ", method.PathPart,
+			" is not validated: ", err)
+		return nil
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+
+	messages := make([]string, 0, len(violations))
+	causes := make([]http_tools.Error, 0, len(violations))
+	for _, violation := range violations {
+		messages = append(messages, violation.Location+": "+violation.Message)
+		causes = append(causes, http_tools.Error{Type: http_tools.ContractViolationError, Info: violation.Message,
+			Location: violation.Location})
+	}
+	service.violations.record(handlerID, method, resp.StatusCode, strings.Join(messages, "; "))
+	service.logger.Warn("response of handler ", handlerID, " ", method.MethodType, " ", method.PathPart,
+		" with status ", resp.StatusCode, " violates its schema: ", strings.Join(messages, "; "))
+
+	if mode != ResponseValidationReject {
+		return nil
+	}
+	return &http_tools.Error{Type: http_tools.ContractViolationError,
+		Info: "handler response does not match the method schema", Causes: causes}
+}
+
+// GetContractViolations returns the counters of responses which did not match the response schemas of the handler,
+// the key must be the owner key of the handler or an admin key
+func (service *Service) GetContractViolations(handlerRef, key string) ([]MethodViolations, *http_tools.Error) {
+	handlerID, httpErr := service.resolveHandlerID(handlerRef)
+	if httpErr != nil {
+		return nil, httpErr
+	}
+	if httpErr = service.authorize(handlerID, key); httpErr != nil {
+		return nil, httpErr
+	}
+
+	if _, httpErr = service.handlersRepo.GetSpecification(handlerID); httpErr != nil {
+		return nil, httpErr
+	}
+
+	return service.violations.get(handlerID), nil
+}
+
+// validateRequestBody checks the body against the request schema of the method and returns
+// the buffered body to be forwarded, every violation is reported as a separate error
+func (service *Service) validateRequestBody(method Method, body io.Reader) (io.Reader, *http_tools.Error) {
+	var payload []byte
+	if body != nil {
+		var err error
+		if payload, err = io.ReadAll(body); err != nil {
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+	}
+
+	violations, err := service.schemaValidator.Validate(method.RequestSchema, payload)
+	if err != nil {
+		return nil, &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+	}
+	if len(violations) > 0 {
+		causes := make([]http_tools.Error, 0, len(violations))
+		for _, violation := range violations {
+			causes = append(causes, http_tools.Error{Type: http_tools.ValidationError, Info: violation.Message,
+				Location: violation.Location})
+		}
+		return nil, &http_tools.Error{Type: http_tools.ValidationError,
+			Info: "request body does not match the method schema", Causes: causes}
+	}
+
+	return bytes.NewReader(payload), nil
+}
+
+// prefixedBody is a response body whose beginning was read ahead, closing it closes the original body
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// releasingBody keeps the call counted as in flight until the response is fully consumed by the caller
+type releasingBody struct {
+	io.ReadCloser
+	release func()
+	cancel  context.CancelFunc
+}
+
+func (body *releasingBody) Close() error {
+	err := body.ReadCloser.Close()
+	body.cancel()
+	body.release()
+	return err
+}
+
+// matchMethod finds the specification method whose path template matches the concrete path.
+// Ambiguous templates are rejected on registration, so at most one method can match.
+func (service *Service) matchMethod(spec Specification, path, methodType string) (Method, map[string]string, *http_tools.Error) {
+	path, _, _ = strings.Cut(path, "?")
+
+	for _, method := range spec.Methods {
+		if method.MethodType != methodType {
+			continue
+		}
+
+		template, err := ParsePathTemplate(method.PathPart)
+		if err != nil {
+			service.logger.Warn("stored method has invalid path template: ", err)
+			continue
+		}
+
+		if params, ok := template.Match(path); ok {
+			return method, params, nil
+		}
+	}
+
+	return Method{}, nil, &http_tools.Error{Type: http_tools.NotFound, Info: "endpoint with given params is not found"}
+}
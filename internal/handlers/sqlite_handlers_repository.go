@@ -0,0 +1,1008 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/educ-educ/handlers-service/internal/pkg/postgres"
+	"github.com/google/uuid"
+	"strings"
+	"time"
+)
+
+// sqliteTimeLayout has a fixed width, so the stored timestamps compare and sort as strings
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sqliteSortExpressions maps HandlersFilter.SortBy values to SQL expressions, the handler id breaks ties
+var sqliteSortExpressions = map[string]string{
+	SortByCreatedAt: "h.created_at",
+	SortByName:      "COALESCE(h.name, '')",
+	SortBySocket:    "h.socket_address",
+}
+
+// SQLiteHandlersRepository stores the registry in a local SQLite file, the schema mirrors the Postgres one
+// with tags and JSON columns kept as text
+type SQLiteHandlersRepository struct {
+	logger common.Logger
+	ctx    context.Context
+	db     postgres.Executor
+	// pool is nil for repositories bound to a transaction
+	pool *sql.DB
+}
+
+func NewSQLiteHandlersRepository(logger common.Logger, ctx context.Context, db *sql.DB) *SQLiteHandlersRepository {
+	return &SQLiteHandlersRepository{
+		logger: logger,
+		ctx:    ctx,
+		db:     db,
+		pool:   db,
+	}
+}
+
+// RunInTx calls fn with a repository bound to a single transaction, which is committed if fn succeeds
+// and rolled back otherwise. Calling it on a repository which is already bound to a transaction joins it.
+func (repo *SQLiteHandlersRepository) RunInTx(fn func(repo handlersRepo) *http_tools.Error) *http_tools.Error {
+	if repo.pool == nil {
+		return fn(repo)
+	}
+
+	txCtx, txCancelFunc := context.WithTimeout(repo.ctx, txTimeout)
+	defer txCancelFunc()
+
+	tx, err := repo.pool.BeginTx(txCtx, nil)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	txRepo := &SQLiteHandlersRepository{
+		logger: repo.logger,
+		ctx:    txCtx,
+		db:     tx,
+	}
+	if httpErr := fn(txRepo); httpErr != nil {
+		if err = tx.Rollback(); err != nil {
+			repo.logger.Error(err)
+		}
+		return httpErr
+	}
+
+	if err = tx.Commit(); err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return nil
+}
+
+func (repo *SQLiteHandlersRepository) GetUsedSockets() ([]string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT socket_address FROM handler_instances
+		WHERE handler_id IN (SELECT id FROM handlers WHERE state NOT IN ('pending', 'retired'))`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	sockets := make([]string, 0)
+	socket := ""
+	for rows.Next() {
+		err = rows.Scan(&socket)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		sockets = append(sockets, socket)
+	}
+
+	return sockets, nil
+}
+
+func (repo *SQLiteHandlersRepository) GetSpecification(handlerID string) (Specification, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var (
+		spec          Specification
+		name          sql.NullString
+		tags          string
+		forwardClaims string
+		rateLimits    []byte
+		retryPolicy   []byte
+		timeouts      []byte
+	)
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT socket_address, name, description, owner, tags, balancing, health_path, lease_ttl, response_validation,
+		forward_claims, rate_limits, retry_policy, timeouts FROM handlers WHERE id = ?`, handlerID).
+		Scan(&spec.Socket, &name, &spec.Description, &spec.Owner, &tags, &spec.Balancing,
+			&spec.HealthPath, &spec.LeaseTTL, &spec.ResponseValidation, &forwardClaims, &rateLimits,
+			&retryPolicy, &timeouts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Specification{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	spec.Name = name.String
+	if err = json.Unmarshal([]byte(tags), &spec.Tags); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if err = json.Unmarshal([]byte(forwardClaims), &spec.ForwardClaims); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if spec.RateLimits, err = unmarshalRateLimits(rateLimits); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if spec.RetryPolicy, err = unmarshalRetryPolicy(retryPolicy); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if spec.Timeouts, err = unmarshalTimeouts(timeouts); err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT path_part, method_type, summary, metadata, request_schema, response_schemas, access,
+		rate_limits, retry_policy, timeouts FROM methods WHERE handler_id = ? ORDER BY id`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	methods := make([]Method, 0)
+	for rows.Next() {
+		var (
+			method          Method
+			metadata        []byte
+			requestSchema   []byte
+			responseSchemas []byte
+			access          []byte
+			rateLimits      []byte
+			retryPolicy     []byte
+			timeouts        []byte
+		)
+		err = rows.Scan(&method.PathPart, &method.MethodType, &method.Summary, &metadata, &requestSchema,
+			&responseSchemas, &access, &rateLimits, &retryPolicy, &timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return Specification{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		err = unmarshalMethodJSON(&method, metadata, requestSchema, responseSchemas, access, rateLimits, retryPolicy,
+			timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return Specification{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		methods = append(methods, method)
+	}
+
+	spec.Methods = methods
+
+	instances, httpErr := repo.getInstances(queryCtx, handlerID)
+	if httpErr != nil {
+		return Specification{}, httpErr
+	}
+	spec.Instances = instances
+
+	return spec, nil
+}
+
+func (repo *SQLiteHandlersRepository) getInstances(queryCtx context.Context, handlerID string) ([]Instance, *http_tools.Error) {
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT socket_address, weight FROM handler_instances WHERE handler_id = ? ORDER BY id`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	instances := make([]Instance, 0)
+	instance := Instance{}
+	for rows.Next() {
+		err = rows.Scan(&instance.Socket, &instance.Weight)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		instances = append(instances, instance)
+	}
+
+	return instances, nil
+}
+
+// GetAllSpecifications returns specifications of every handler which is not retired keyed by handler ID
+func (repo *SQLiteHandlersRepository) GetAllSpecifications() (map[string]Specification, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, 5*time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+		response_validation, forward_claims, rate_limits, retry_policy, timeouts FROM handlers WHERE state <> 'retired'`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	specs := make(map[string]Specification)
+	for rows.Next() {
+		var (
+			handlerID     string
+			spec          Specification
+			name          sql.NullString
+			tags          string
+			forwardClaims string
+			rateLimits    []byte
+			retryPolicy   []byte
+			timeouts      []byte
+		)
+		err = rows.Scan(&handlerID, &spec.Socket, &name, &spec.Description, &spec.Owner, &tags,
+			&spec.Balancing, &spec.HealthPath, &spec.LeaseTTL, &spec.ResponseValidation, &forwardClaims, &rateLimits,
+			&retryPolicy, &timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if err = json.Unmarshal([]byte(tags), &spec.Tags); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if err = json.Unmarshal([]byte(forwardClaims), &spec.ForwardClaims); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec.RateLimits, err = unmarshalRateLimits(rateLimits); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec.RetryPolicy, err = unmarshalRetryPolicy(retryPolicy); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec.Timeouts, err = unmarshalTimeouts(timeouts); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		spec.Name = name.String
+		spec.Methods = make([]Method, 0)
+		spec.Instances = make([]Instance, 0)
+		specs[handlerID] = spec
+	}
+
+	methodRows, err := repo.db.QueryContext(queryCtx,
+		`SELECT handler_id, path_part, method_type, summary, metadata, request_schema, response_schemas, access,
+		rate_limits, retry_policy, timeouts FROM methods ORDER BY id`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = methodRows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	for methodRows.Next() {
+		var (
+			handlerID       string
+			method          Method
+			metadata        []byte
+			requestSchema   []byte
+			responseSchemas []byte
+			access          []byte
+			rateLimits      []byte
+			retryPolicy     []byte
+			timeouts        []byte
+		)
+		err = methodRows.Scan(&handlerID, &method.PathPart, &method.MethodType, &method.Summary, &metadata,
+			&requestSchema, &responseSchemas, &access, &rateLimits, &retryPolicy, &timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		err = unmarshalMethodJSON(&method, metadata, requestSchema, responseSchemas, access, rateLimits, retryPolicy,
+			timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if spec, ok := specs[handlerID]; ok {
+			spec.Methods = append(spec.Methods, method)
+			specs[handlerID] = spec
+		}
+	}
+
+	instanceRows, err := repo.db.QueryContext(queryCtx,
+		`SELECT handler_id, socket_address, weight FROM handler_instances ORDER BY id`)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = instanceRows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	for instanceRows.Next() {
+		var (
+			handlerID string
+			instance  Instance
+		)
+		err = instanceRows.Scan(&handlerID, &instance.Socket, &instance.Weight)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if spec, ok := specs[handlerID]; ok {
+			spec.Instances = append(spec.Instances, instance)
+			specs[handlerID] = spec
+		}
+	}
+
+	return specs, nil
+}
+
+// ListHandlers returns a page of handler summaries matching the filter and the cursor of the next page,
+// which is empty on the last page
+func (repo *SQLiteHandlersRepository) ListHandlers(filter HandlersFilter) ([]HandlerSummary, string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, 2*time.Second)
+	defer queryCancelFunc()
+
+	if filter.SortBy == "" {
+		filter.SortBy = SortByCreatedAt
+	}
+	if filter.Limit == 0 {
+		filter.Limit = defaultListLimit
+	}
+	sortExpression := sqliteSortExpressions[filter.SortBy]
+
+	conditions := make([]string, 0)
+	args := make([]any, 0)
+
+	if filter.SocketHost != "" {
+		// without regular expressions the host is matched between "://" and the first port, path, query
+		// or fragment delimiter
+		host := "%://" + strings.ToLower(filter.SocketHost)
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM handler_instances hi WHERE hi.handler_id = h.id
+			AND (LOWER(hi.socket_address) LIKE ? OR LOWER(hi.socket_address) LIKE ? OR LOWER(hi.socket_address) LIKE ?
+			OR LOWER(hi.socket_address) LIKE ? OR LOWER(hi.socket_address) LIKE ?))`)
+		args = append(args, host, host+":%", host+"/%", host+"?%", host+"#%")
+	}
+	if filter.State != "" {
+		conditions = append(conditions, `h.state = ?`)
+		args = append(args, filter.State)
+	} else {
+		conditions = append(conditions, `h.state <> 'retired'`)
+	}
+	if filter.PathContains != "" || filter.MethodType != "" {
+		methodConditions := make([]string, 0, 2)
+		if filter.PathContains != "" {
+			methodConditions = append(methodConditions, `INSTR(LOWER(m.path_part), LOWER(?)) > 0`)
+			args = append(args, filter.PathContains)
+		}
+		if filter.MethodType != "" {
+			methodConditions = append(methodConditions, `UPPER(m.method_type) = UPPER(?)`)
+			args = append(args, filter.MethodType)
+		}
+		conditions = append(conditions, `EXISTS (SELECT 1 FROM methods m WHERE m.handler_id = h.id AND `+
+			strings.Join(methodConditions, " AND ")+`)`)
+	}
+
+	direction, comparison := "ASC", ">"
+	if filter.Descending {
+		direction, comparison = "DESC", "<"
+	}
+	if filter.Cursor != "" {
+		cursor, err := decodeCursor(filter.Cursor)
+		if err != nil {
+			return nil, "", &http_tools.Error{Type: http_tools.ValidationError, Info: err.Error()}
+		}
+
+		sortKey := cursor.SortKey
+		if filter.SortBy == SortByCreatedAt {
+			createdAt, err := time.Parse(time.RFC3339Nano, sortKey)
+			if err != nil {
+				return nil, "", &http_tools.Error{Type: http_tools.ValidationError, Info: errInvalidCursor.Error()}
+			}
+			sortKey = createdAt.UTC().Format(sqliteTimeLayout)
+		}
+		conditions = append(conditions, `(`+sortExpression+`, h.id) `+comparison+` (?, ?)`)
+		args = append(args, sortKey, cursor.HandlerID)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT h.id, h.name, h.description, h.owner, h.tags, h.socket_address, h.state, h.created_at,
+			(SELECT COUNT(*) FROM handler_instances hi WHERE hi.handler_id = h.id),
+			(SELECT COUNT(*) FROM methods m WHERE m.handler_id = h.id)
+		FROM handlers h `+where+`
+		ORDER BY `+sortExpression+` `+direction+`, h.id `+direction+`
+		LIMIT ?`, append(args, filter.Limit+1)...)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	summaries := make([]HandlerSummary, 0, filter.Limit)
+	for rows.Next() {
+		var (
+			summary   HandlerSummary
+			name      sql.NullString
+			tags      string
+			createdAt string
+		)
+		err = rows.Scan(&summary.HandlerID, &name, &summary.Description, &summary.Owner, &tags,
+			&summary.Socket, &summary.State, &createdAt, &summary.InstancesCount, &summary.MethodsCount)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if err = json.Unmarshal([]byte(tags), &summary.Tags); err != nil {
+			repo.logger.Error(err)
+			return nil, "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if summary.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+			repo.logger.Error(err)
+			return nil, "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		summary.Name = name.String
+		summaries = append(summaries, summary)
+	}
+
+	nextCursor := ""
+	if len(summaries) > filter.Limit {
+		summaries = summaries[:filter.Limit]
+		last := summaries[len(summaries)-1]
+		nextCursor = encodeCursor(listCursor{SortKey: last.sortKey(filter.SortBy), HandlerID: last.HandlerID})
+	}
+
+	return summaries, nextCursor, nil
+}
+
+func (repo *SQLiteHandlersRepository) GetHandlerIDByName(name string) (string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var handlerID string
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT id FROM handlers WHERE name = ? AND state <> 'retired'`, name).Scan(&handlerID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given name is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return handlerID, nil
+}
+
+func (repo *SQLiteHandlersRepository) AddHandlerInstance(specification Specification) (string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	tags, err := json.Marshal(nonNilTags(specification.Tags))
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	forwardClaims, err := json.Marshal(nonNilTags(specification.ForwardClaims))
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	rateLimits, err := marshalRateLimits(specification.RateLimits)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	retryPolicy, err := marshalRetryPolicy(specification.RetryPolicy)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	timeouts, err := marshalTimeouts(specification.Timeouts)
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	id := uuid.New().String()
+	_, err = repo.db.ExecContext(queryCtx,
+		`INSERT INTO handlers (id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+		response_validation, forward_claims, rate_limits, retry_policy, timeouts, lease_expires_at, state,
+		created_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id, specification.Socket, postgres.NewNullableString(specification.Name), specification.Description,
+		specification.Owner, string(tags), specification.Balancing, specification.HealthPath,
+		specification.LeaseTTL, specification.ResponseValidation, string(forwardClaims), rateLimits,
+		retryPolicy, timeouts, sqliteLeaseExpiry(specification.LeaseTTL),
+		initialState(specification), time.Now().UTC().Format(sqliteTimeLayout))
+	if err != nil {
+		repo.logger.Error(err)
+		return "", sqliteUniqueError(err)
+	}
+
+	return id, nil
+}
+
+func (repo *SQLiteHandlersRepository) AddMethods(handlerID string, methods []Method) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	if len(methods) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(methods))
+	args := make([]any, 0, 9*len(methods))
+	for _, method := range methods {
+		metadata, err := marshalJSONObject(method.Metadata)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		responseSchemas, err := marshalJSONObject(method.ResponseSchemas)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		access, err := marshalMethodAccess(method.Access)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		rateLimits, err := marshalRateLimits(method.RateLimits)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		retryPolicy, err := marshalRetryPolicy(method.RetryPolicy)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		timeouts, err := marshalTimeouts(method.Timeouts)
+		if err != nil {
+			repo.logger.Error(err)
+			return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+
+		values = append(values, "(?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
+		args = append(args, handlerID, method.PathPart, method.MethodType, method.Summary, metadata,
+			nullableJSON(method.RequestSchema), responseSchemas, access, rateLimits, retryPolicy, timeouts)
+	}
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`INSERT INTO methods (handler_id, path_part, method_type, summary, metadata, request_schema, response_schemas,
+		access, rate_limits, retry_policy, timeouts) VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return nil
+}
+
+func (repo *SQLiteHandlersRepository) AddInstances(handlerID string, instances []Instance) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	if len(instances) == 0 {
+		return nil
+	}
+
+	values := make([]string, 0, len(instances))
+	args := make([]any, 0, 3*len(instances))
+	for _, instance := range instances {
+		values = append(values, "(?, ?, ?)")
+		args = append(args, handlerID, instance.Socket, instance.Weight)
+	}
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`INSERT INTO handler_instances (handler_id, socket_address, weight) VALUES `+strings.Join(values, ", "), args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return sqliteUniqueError(err)
+	}
+
+	return nil
+}
+
+// sqliteUniqueError reports violations of the unique name and socket indexes like postgresUniqueError
+func sqliteUniqueError(err error) *http_tools.Error {
+	switch {
+	case strings.Contains(err.Error(), "UNIQUE constraint failed: handlers.name"):
+		return &http_tools.Error{Type: http_tools.AlreadyExist, Info: "name is already in use"}
+	case strings.Contains(err.Error(), "UNIQUE constraint failed: handler_instances.socket_address"):
+		return &http_tools.Error{Type: http_tools.ValidationError, Info: "socket is already in use"}
+	}
+	return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+}
+
+// SetHandlerState moves the handler to the lifecycle state, the transition is checked by the service
+func (repo *SQLiteHandlersRepository) SetHandlerState(handlerID, state string) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	result, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET state = ? WHERE id = ?`, state, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return sqliteUniqueError(err)
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return nil
+}
+
+func (repo *SQLiteHandlersRepository) RemoveHandler(handlerID string) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`DELETE FROM handlers WHERE id = ?`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return nil
+}
+
+func (repo *SQLiteHandlersRepository) UpdateHandler(handlerID string, specification Specification) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	tags, err := json.Marshal(nonNilTags(specification.Tags))
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	forwardClaims, err := json.Marshal(nonNilTags(specification.ForwardClaims))
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	rateLimits, err := marshalRateLimits(specification.RateLimits)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	retryPolicy, err := marshalRetryPolicy(specification.RetryPolicy)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	timeouts, err := marshalTimeouts(specification.Timeouts)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	_, err = repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET socket_address = ?, name = ?, description = ?, owner = ?, tags = ?, balancing = ?,
+		health_path = ?, lease_ttl = ?, response_validation = ?, forward_claims = ?, rate_limits = ?, retry_policy = ?,
+		timeouts = ?, lease_expires_at = ? WHERE id = ?`,
+		specification.Socket, postgres.NewNullableString(specification.Name), specification.Description,
+		specification.Owner, string(tags), specification.Balancing, specification.HealthPath, specification.LeaseTTL,
+		specification.ResponseValidation, string(forwardClaims), rateLimits, retryPolicy, timeouts,
+		sqliteLeaseExpiry(specification.LeaseTTL), handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return sqliteUniqueError(err)
+	}
+
+	_, err = repo.db.ExecContext(queryCtx,
+		`DELETE FROM methods WHERE handler_id = ?`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	_, err = repo.db.ExecContext(queryCtx,
+		`DELETE FROM handler_instances WHERE handler_id = ?`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	queryCancelFunc()
+
+	if httpErr := repo.AddInstances(handlerID, specification.Instances); httpErr != nil {
+		return httpErr
+	}
+
+	return repo.AddMethods(handlerID, specification.Methods)
+}
+
+// sqliteLeaseExpiry returns the expiry of a lease starting now as stored by SQLite
+func sqliteLeaseExpiry(leaseTTL int) sql.NullString {
+	expiresAt := leaseExpiry(leaseTTL)
+	if expiresAt == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: expiresAt.UTC().Format(sqliteTimeLayout), Valid: true}
+}
+
+func (repo *SQLiteHandlersRepository) GetHandlerStatus(handlerID string) (HandlerStatus, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var (
+		status         HandlerStatus
+		leaseExpiresAt sql.NullString
+	)
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT state, lease_expires_at FROM handlers WHERE id = ?`, handlerID).Scan(&status.State, &leaseExpiresAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return HandlerStatus{}, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return HandlerStatus{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if leaseExpiresAt.Valid {
+		expiresAt, err := time.Parse(sqliteTimeLayout, leaseExpiresAt.String)
+		if err != nil {
+			repo.logger.Error(err)
+			return HandlerStatus{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		status.LeaseExpiresAt = &expiresAt
+	}
+
+	return status, nil
+}
+
+// RenewLease moves the lease expiry forward and activates the handler if it is pending
+func (repo *SQLiteHandlersRepository) RenewLease(handlerID string, expiresAt time.Time) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	_, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET lease_expires_at = ?,
+		state = CASE WHEN state = 'pending' THEN 'active' ELSE state END WHERE id = ?`,
+		expiresAt.UTC().Format(sqliteTimeLayout), handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return sqliteUniqueError(err)
+	}
+
+	return nil
+}
+
+// DeactivateExpiredLeases moves active handlers whose lease lapsed before now back to pending and returns their IDs
+func (repo *SQLiteHandlersRepository) DeactivateExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	return repo.queryIDs(
+		`UPDATE handlers SET state = 'pending' WHERE state = 'active' AND lease_expires_at < ? RETURNING id`,
+		now.UTC().Format(sqliteTimeLayout))
+}
+
+// RetireExpiredLeases retires handlers whose lease lapsed before now and returns their IDs
+func (repo *SQLiteHandlersRepository) RetireExpiredLeases(now time.Time) ([]string, *http_tools.Error) {
+	return repo.queryIDs(`UPDATE handlers SET state = 'retired' WHERE state <> 'retired' AND lease_expires_at < ?
+		RETURNING id`,
+		now.UTC().Format(sqliteTimeLayout))
+}
+
+func (repo *SQLiteHandlersRepository) queryIDs(query string, args ...any) ([]string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx, query, args...)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	ids := make([]string, 0)
+	id := ""
+	for rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, nil
+}
+
+func (repo *SQLiteHandlersRepository) AddRevision(handlerID string, specification Specification, author string,
+	rolledBackFrom *int) (int, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	specJSON, err := json.Marshal(specification)
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	// SQLite has no row locks, the no-op update takes the database write lock till the end of the transaction,
+	// so concurrent changes of the handler do not compute the same next revision
+	result, err := repo.db.ExecContext(queryCtx, `UPDATE handlers SET id = id WHERE id = ?`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if locked, err := result.RowsAffected(); err == nil && locked == 0 {
+		return 0, &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	var revision int
+	err = repo.db.QueryRowContext(queryCtx,
+		`INSERT INTO specification_revisions (handler_id, revision, specification, author, rolled_back_from, created_at)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ? FROM specification_revisions WHERE handler_id = ?
+		RETURNING revision`,
+		handlerID, string(specJSON), author, rolledBackFrom, time.Now().UTC().Format(sqliteTimeLayout),
+		handlerID).Scan(&revision)
+	if err != nil {
+		repo.logger.Error(err)
+		return 0, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return revision, nil
+}
+
+func (repo *SQLiteHandlersRepository) GetRevisions(handlerID string) ([]RevisionInfo, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	rows, err := repo.db.QueryContext(queryCtx,
+		`SELECT revision, author, rolled_back_from, created_at FROM specification_revisions
+		WHERE handler_id = ? ORDER BY revision`, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	defer func() {
+		if err = rows.Close(); err != nil {
+			repo.logger.Error(err)
+		}
+	}()
+
+	revisions := make([]RevisionInfo, 0)
+	for rows.Next() {
+		var (
+			revision       RevisionInfo
+			rolledBackFrom sql.NullInt32
+			createdAt      string
+		)
+		err = rows.Scan(&revision.Revision, &revision.Author, &rolledBackFrom, &createdAt)
+		if err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+		}
+		if revision.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+			repo.logger.Error(err)
+			return nil, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+		}
+		if rolledBackFrom.Valid {
+			from := int(rolledBackFrom.Int32)
+			revision.RolledBackFrom = &from
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, nil
+}
+
+func (repo *SQLiteHandlersRepository) GetRevision(handlerID string, revisionNumber int) (Revision, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	var (
+		revision       Revision
+		rolledBackFrom sql.NullInt32
+		createdAt      string
+		specJSON       []byte
+	)
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT revision, author, rolled_back_from, created_at, specification FROM specification_revisions
+		WHERE handler_id = ? AND revision = ?`, handlerID, revisionNumber).
+		Scan(&revision.Revision, &revision.Author, &rolledBackFrom, &createdAt, &specJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Revision{}, &http_tools.Error{Type: http_tools.NotFound, Info: "revision with given number is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return Revision{}, &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if revision.CreatedAt, err = time.Parse(sqliteTimeLayout, createdAt); err != nil {
+		repo.logger.Error(err)
+		return Revision{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+	if rolledBackFrom.Valid {
+		from := int(rolledBackFrom.Int32)
+		revision.RolledBackFrom = &from
+	}
+
+	if err = json.Unmarshal(specJSON, &revision.Specification); err != nil {
+		repo.logger.Error(err)
+		return Revision{}, &http_tools.Error{Type: http_tools.ParseError, Info: err.Error()}
+	}
+
+	return revision, nil
+}
+
+func (repo *SQLiteHandlersRepository) GetOwnerKeyHash(handlerID string) (string, *http_tools.Error) {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	hash := ""
+	err := repo.db.QueryRowContext(queryCtx,
+		`SELECT COALESCE(owner_key_hash, '') FROM handlers WHERE id = ?`, handlerID).Scan(&hash)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+	if err != nil {
+		repo.logger.Error(err)
+		return "", &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+
+	return hash, nil
+}
+
+func (repo *SQLiteHandlersRepository) SetOwnerKeyHash(handlerID, hash string) *http_tools.Error {
+	queryCtx, queryCancelFunc := context.WithTimeout(repo.ctx, time.Second)
+	defer queryCancelFunc()
+
+	result, err := repo.db.ExecContext(queryCtx,
+		`UPDATE handlers SET owner_key_hash = ? WHERE id = ?`, hash, handlerID)
+	if err != nil {
+		repo.logger.Error(err)
+		return &http_tools.Error{Type: http_tools.DatabaseError, Info: err.Error()}
+	}
+	if updated, err := result.RowsAffected(); err == nil && updated == 0 {
+		return &http_tools.Error{Type: http_tools.NotFound, Info: "handler with given id is not found"}
+	}
+
+	return nil
+}
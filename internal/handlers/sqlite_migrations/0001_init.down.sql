@@ -0,0 +1,7 @@
+DROP TABLE IF EXISTS specification_revisions;
+
+DROP TABLE IF EXISTS handler_instances;
+
+DROP TABLE IF EXISTS methods;
+
+DROP TABLE IF EXISTS handlers;
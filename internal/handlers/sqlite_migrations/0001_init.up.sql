@@ -0,0 +1,48 @@
+-- timestamps are stored as UTC text of a fixed width, so they compare and sort as strings
+CREATE TABLE IF NOT EXISTS handlers (
+    id TEXT PRIMARY KEY,
+    socket_address TEXT,
+    name TEXT UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL DEFAULT '',
+    -- JSON array of strings
+    tags TEXT NOT NULL DEFAULT '[]',
+    balancing TEXT NOT NULL DEFAULT 'round_robin',
+    health_path TEXT NOT NULL DEFAULT '',
+    lease_ttl INTEGER NOT NULL DEFAULT 0,
+    response_validation TEXT NOT NULL DEFAULT 'off',
+    lease_expires_at TEXT,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS methods (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    handler_id TEXT NOT NULL REFERENCES handlers (id) ON DELETE CASCADE,
+    path_part TEXT,
+    method_type TEXT,
+    summary TEXT NOT NULL DEFAULT '',
+    metadata TEXT NOT NULL DEFAULT '{}',
+    request_schema TEXT,
+    response_schemas TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE TABLE IF NOT EXISTS handler_instances (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    handler_id TEXT NOT NULL REFERENCES handlers (id) ON DELETE CASCADE,
+    socket_address TEXT NOT NULL,
+    weight INTEGER NOT NULL DEFAULT 1
+);
+
+-- sockets of deactivated handlers may be reused, so uniqueness among active handlers is checked by the service
+CREATE INDEX IF NOT EXISTS handler_instances_socket_address_idx ON handler_instances (socket_address);
+
+CREATE TABLE IF NOT EXISTS specification_revisions (
+    handler_id TEXT NOT NULL REFERENCES handlers (id) ON DELETE CASCADE,
+    revision INTEGER NOT NULL,
+    specification TEXT NOT NULL,
+    author TEXT NOT NULL DEFAULT '',
+    rolled_back_from INTEGER,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now')),
+    PRIMARY KEY (handler_id, revision)
+);
@@ -0,0 +1,3 @@
+-- SQLite databases never had the baseline schema, 0001_init creates the registry schema at once. The version is kept,
+-- so both backends number the same schema steps the same way.
+SELECT 1;
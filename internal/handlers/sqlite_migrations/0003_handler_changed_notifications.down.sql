@@ -0,0 +1,2 @@
+-- nothing to revert, see the up script
+SELECT 1;
@@ -0,0 +1,3 @@
+-- change notifications are sent by Postgres triggers only, SQLite is used by a single replica, which has nothing
+-- to notify. The version is kept, so both backends number the same schema steps the same way.
+SELECT 1;
@@ -0,0 +1,33 @@
+-- retired handlers may share names, they are purged to restore the unique constraint. Foreign keys are off
+-- during migrations, so the rows referencing them are deleted explicitly.
+DELETE FROM methods WHERE handler_id IN (SELECT id FROM handlers WHERE state = 'retired');
+DELETE FROM handler_instances WHERE handler_id IN (SELECT id FROM handlers WHERE state = 'retired');
+DELETE FROM specification_revisions WHERE handler_id IN (SELECT id FROM handlers WHERE state = 'retired');
+DELETE FROM handlers WHERE state = 'retired';
+DROP INDEX handlers_name_key;
+
+CREATE TABLE handlers_new (
+    id TEXT PRIMARY KEY,
+    socket_address TEXT,
+    name TEXT UNIQUE,
+    description TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL DEFAULT '',
+    -- JSON array of strings
+    tags TEXT NOT NULL DEFAULT '[]',
+    balancing TEXT NOT NULL DEFAULT 'round_robin',
+    health_path TEXT NOT NULL DEFAULT '',
+    lease_ttl INTEGER NOT NULL DEFAULT 0,
+    response_validation TEXT NOT NULL DEFAULT 'off',
+    lease_expires_at TEXT,
+    active INTEGER NOT NULL DEFAULT 1,
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+INSERT INTO handlers_new (id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+    response_validation, lease_expires_at, active, created_at)
+SELECT id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+    response_validation, lease_expires_at, state <> 'pending', created_at
+FROM handlers;
+
+DROP TABLE handlers;
+ALTER TABLE handlers_new RENAME TO handlers;
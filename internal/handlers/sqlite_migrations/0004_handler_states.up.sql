@@ -0,0 +1,30 @@
+-- SQLite can't drop the unique constraint of the name, so the table is rebuilt. The migrator turns foreign keys off,
+-- so dropping the old table doesn't cascade to the tables referencing it.
+CREATE TABLE handlers_new (
+    id TEXT PRIMARY KEY,
+    socket_address TEXT,
+    name TEXT,
+    description TEXT NOT NULL DEFAULT '',
+    owner TEXT NOT NULL DEFAULT '',
+    -- JSON array of strings
+    tags TEXT NOT NULL DEFAULT '[]',
+    balancing TEXT NOT NULL DEFAULT 'round_robin',
+    health_path TEXT NOT NULL DEFAULT '',
+    lease_ttl INTEGER NOT NULL DEFAULT 0,
+    response_validation TEXT NOT NULL DEFAULT 'off',
+    lease_expires_at TEXT,
+    state TEXT NOT NULL DEFAULT 'active',
+    created_at TEXT NOT NULL DEFAULT (strftime('%Y-%m-%dT%H:%M:%f000000Z', 'now'))
+);
+
+INSERT INTO handlers_new (id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+    response_validation, lease_expires_at, state, created_at)
+SELECT id, socket_address, name, description, owner, tags, balancing, health_path, lease_ttl,
+    response_validation, lease_expires_at, CASE WHEN active THEN 'active' ELSE 'pending' END, created_at
+FROM handlers;
+
+DROP TABLE handlers;
+ALTER TABLE handlers_new RENAME TO handlers;
+
+-- retired handlers keep their names in the history, so names are unique only among the other handlers
+CREATE UNIQUE INDEX handlers_name_key ON handlers (name) WHERE state <> 'retired';
@@ -0,0 +1,3 @@
+-- SHA-256 of the owner key issued on registration, handlers registered before owner keys existed have none
+-- and can be changed only with an admin key
+ALTER TABLE handlers ADD COLUMN owner_key_hash TEXT;
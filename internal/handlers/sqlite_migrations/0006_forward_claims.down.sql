@@ -0,0 +1 @@
+ALTER TABLE handlers DROP COLUMN forward_claims;
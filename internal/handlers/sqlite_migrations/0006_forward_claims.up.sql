@@ -0,0 +1,2 @@
+-- claims of the caller token forwarded to the handler, see Specification.ForwardClaims
+ALTER TABLE handlers ADD COLUMN forward_claims TEXT NOT NULL DEFAULT '[]';
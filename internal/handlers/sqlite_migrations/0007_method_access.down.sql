@@ -0,0 +1 @@
+ALTER TABLE methods DROP COLUMN access;
@@ -0,0 +1,2 @@
+ALTER TABLE methods DROP COLUMN rate_limits;
+ALTER TABLE handlers DROP COLUMN rate_limits;
@@ -0,0 +1,4 @@
+-- rate limits of handlers and methods, see RateLimits. Buckets shared by replicas need Postgres,
+-- so their table is not mirrored here.
+ALTER TABLE handlers ADD COLUMN rate_limits TEXT;
+ALTER TABLE methods ADD COLUMN rate_limits TEXT;
@@ -0,0 +1,2 @@
+ALTER TABLE methods DROP COLUMN timeouts;
+ALTER TABLE handlers DROP COLUMN timeouts;
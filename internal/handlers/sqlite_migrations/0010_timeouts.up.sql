@@ -0,0 +1,3 @@
+-- timeouts of calls to handlers and methods, see Timeouts
+ALTER TABLE handlers ADD COLUMN timeouts TEXT;
+ALTER TABLE methods ADD COLUMN timeouts TEXT;
@@ -0,0 +1,33 @@
+-- sockets are unique among the handlers holding them, which are all but pending and retired ones. The state of
+-- the handler is copied to its instances by triggers, so a partial unique index can enforce it. New instances
+-- hold no socket until the insert trigger checks the state of their handler.
+ALTER TABLE handler_instances ADD COLUMN holds_socket INTEGER NOT NULL DEFAULT 0;
+UPDATE handler_instances SET holds_socket = (
+    SELECT state NOT IN ('pending', 'retired') FROM handlers WHERE handlers.id = handler_instances.handler_id
+);
+
+-- handlers registered before the index might share sockets, they are left to the operator to sort out. SQLite can
+-- raise errors only in triggers, so the duplicates are inserted into a table whose trigger refuses them.
+CREATE TEMP TABLE socket_conflicts (socket_address TEXT);
+CREATE TEMP TRIGGER socket_conflicts_refused BEFORE INSERT ON socket_conflicts
+BEGIN
+    SELECT RAISE(ABORT, 'sockets are held by several handlers, retire all but one handler per socket');
+END;
+INSERT INTO socket_conflicts
+SELECT socket_address FROM handler_instances WHERE holds_socket GROUP BY socket_address HAVING COUNT(*) > 1;
+DROP TABLE socket_conflicts;
+
+DROP INDEX handler_instances_socket_address_idx;
+CREATE UNIQUE INDEX handler_instances_socket_address_key ON handler_instances (socket_address) WHERE holds_socket;
+
+CREATE TRIGGER handler_instances_holds_socket AFTER INSERT ON handler_instances
+BEGIN
+    UPDATE handler_instances SET holds_socket = (
+        SELECT state NOT IN ('pending', 'retired') FROM handlers WHERE id = NEW.handler_id
+    ) WHERE id = NEW.id;
+END;
+
+CREATE TRIGGER handlers_hold_sockets AFTER UPDATE OF state ON handlers WHEN OLD.state IS NOT NEW.state
+BEGIN
+    UPDATE handler_instances SET holds_socket = NEW.state NOT IN ('pending', 'retired') WHERE handler_id = NEW.id;
+END;
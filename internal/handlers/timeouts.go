@@ -0,0 +1,137 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultTimeouts apply to the calls of handlers which don't set their own timeouts, the first byte is
+// awaited until the total timeout when its timeout is not set
+var DefaultTimeouts = Timeouts{ConnectMs: 2000, TotalMs: 5000}
+
+// DefaultMaxTimeout is the longest total timeout handlers may set by default
+const DefaultMaxTimeout = 10 * time.Minute
+
+type connectTimeoutKey struct{}
+
+// upstreamClient is shared by the calls and the probes of handlers, it dials with the connect timeout stored
+// in the context of the request. Redirects are passed to the caller, following them could reach paths
+// the handler doesn't expose.
+var upstreamClient = newUpstreamClient()
+
+func newUpstreamClient() *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = func(ctx context.Context, network, address string) (net.Conn, error) {
+		dialer := net.Dialer{KeepAlive: 30 * time.Second}
+		if timeout, ok := ctx.Value(connectTimeoutKey{}).(time.Duration); ok {
+			dialer.Timeout = timeout
+		}
+		return dialer.DialContext(ctx, network, address)
+	}
+
+	return &http.Client{
+		Transport: transport,
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// withConnectTimeout makes connections opened for requests with the context time out after the timeout
+func withConnectTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, connectTimeoutKey{}, timeout)
+}
+
+// resolveTimeouts takes the timeouts the method doesn't set from the handler and then from the defaults
+func resolveTimeouts(defaults Timeouts, handler, method *Timeouts) Timeouts {
+	resolved := defaults
+	for _, timeouts := range []*Timeouts{handler, method} {
+		if timeouts == nil {
+			continue
+		}
+		if timeouts.ConnectMs > 0 {
+			resolved.ConnectMs = timeouts.ConnectMs
+		}
+		if timeouts.FirstByteMs > 0 {
+			resolved.FirstByteMs = timeouts.FirstByteMs
+		}
+		if timeouts.TotalMs > 0 {
+			resolved.TotalMs = timeouts.TotalMs
+		}
+	}
+	return resolved
+}
+
+func (timeouts Timeouts) connect() time.Duration {
+	return time.Duration(timeouts.ConnectMs) * time.Millisecond
+}
+
+func (timeouts Timeouts) firstByte() time.Duration {
+	return time.Duration(timeouts.FirstByteMs) * time.Millisecond
+}
+
+func (timeouts Timeouts) total() time.Duration {
+	return time.Duration(timeouts.TotalMs) * time.Millisecond
+}
+
+// SetDefaultTimeouts replaces DefaultTimeouts and DefaultMaxTimeout
+func (service *Service) SetDefaultTimeouts(defaults Timeouts, maxTimeout time.Duration) {
+	service.defaultTimeouts = defaults
+	service.maxTimeout = maxTimeout
+}
+
+// checkTimeouts makes sure no method of the handler runs longer than the registry allows
+func (service *Service) checkTimeouts(specification Specification) *http_tools.Error {
+	methods := append([]Method{{}}, specification.Methods...)
+	for _, method := range methods {
+		resolved := resolveTimeouts(service.defaultTimeouts, specification.Timeouts, method.Timeouts)
+		if resolved.total() > service.maxTimeout {
+			return &http_tools.Error{Type: http_tools.ValidationError, Info: "total timeout of " +
+				resolved.total().String() + " exceeds the limit of " + service.maxTimeout.String()}
+		}
+	}
+	return nil
+}
+
+// timeoutError is the cause of an attempt cancelled because it exceeded one of its timeouts
+type timeoutError struct {
+	name    string
+	timeout time.Duration
+}
+
+func (err *timeoutError) Error() string {
+	return err.name + " timeout of " + err.timeout.String() + " is exceeded"
+}
+
+// Timeout and Temporary make the error a net.Error, so the retry policies see it as a timeout
+func (err *timeoutError) Timeout() bool {
+	return true
+}
+
+func (err *timeoutError) Temporary() bool {
+	return true
+}
+
+// upstreamTimeout tells which timeout the failed attempt exceeded, it returns nil for other failures.
+// The context is the one of the whole call.
+func upstreamTimeout(ctx context.Context, timeouts Timeouts, err error) *http_tools.Error {
+	var (
+		exceeded *timeoutError
+		opErr    *net.OpError
+	)
+	switch {
+	case errors.As(err, &exceeded):
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		exceeded = &timeoutError{name: "total", timeout: timeouts.total()}
+	case errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout():
+		exceeded = &timeoutError{name: "connect", timeout: timeouts.connect()}
+	default:
+		return nil
+	}
+
+	return &http_tools.Error{Type: http_tools.UpstreamTimeoutError, Info: exceeded.Error()}
+}
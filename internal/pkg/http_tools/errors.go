@@ -8,21 +8,51 @@ import (
 )
 
 const (
-	ExcelError           string = "excel_error"
-	FileServerError             = "file_server_error"
-	DatabaseError               = "database_error"
-	ValidationError             = "validation_error"
-	AlreadyExist                = "already_exist"
-	ForbiddenActionError        = "forbidden_action_error"
-	NotFound                    = "not_found"
-	ParseError                  = "parse_error"
-	FileHeaderOpenError         = "file_header_open_error"
-	NetworkError                = "network_error"
+	ExcelError             string = "excel_error"
+	FileServerError               = "file_server_error"
+	DatabaseError                 = "database_error"
+	ValidationError               = "validation_error"
+	AlreadyExist                  = "already_exist"
+	ForbiddenActionError          = "forbidden_action_error"
+	NotFound                      = "not_found"
+	ParseError                    = "parse_error"
+	FileHeaderOpenError           = "file_header_open_error"
+	NetworkError                  = "network_error"
+	UnavailableError              = "unavailable_error"
+	ContractViolationError        = "contract_violation_error"
+	UnauthorizedError             = "unauthorized_error"
+	InvalidTokenError             = "invalid_token_error"
+	AccessDeniedError             = "access_denied_error"
+	RateLimitedError              = "rate_limited_error"
+	CircuitOpenError              = "circuit_open"
+	UpstreamTimeoutError          = "upstream_timeout"
 )
 
+// errorCodes holds response codes of the error types which are not client errors
+var errorCodes = map[string]int{
+	ExcelError:             http.StatusInternalServerError,
+	FileServerError:        http.StatusInternalServerError,
+	DatabaseError:          http.StatusInternalServerError,
+	FileHeaderOpenError:    http.StatusInternalServerError,
+	UnavailableError:       http.StatusServiceUnavailable,
+	ContractViolationError: http.StatusBadGateway,
+	UnauthorizedError:      http.StatusUnauthorized,
+	InvalidTokenError:      http.StatusUnauthorized,
+	AccessDeniedError:      http.StatusForbidden,
+	RateLimitedError:       http.StatusTooManyRequests,
+	CircuitOpenError:       http.StatusServiceUnavailable,
+	UpstreamTimeoutError:   http.StatusGatewayTimeout,
+}
+
 type Error struct {
 	Type string `json:"type"`
 	Info string `json:"info"`
+	// Location is a JSON pointer to the part of the request the error is about
+	Location string `json:"location,omitempty"`
+	// Causes are reported to the client as separate errors instead of this one
+	Causes []Error `json:"-"`
+	// Headers are set on the error response, like Retry-After of throttled calls
+	Headers http.Header `json:"-"`
 }
 
 func (err Error) Error() string {
@@ -52,9 +82,19 @@ func ErrorsMiddleware(logger common.Logger, maxBodySizeToSave int64) gin.Handler
 		errs := make([]error, 0, len(c.Errors))
 		for _, err := range c.Errors {
 			if customErr, ok := err.Err.(Error); ok {
-				if customErr.Type == ExcelError || customErr.Type == FileServerError ||
-					customErr.Type == DatabaseError || customErr.Type == FileHeaderOpenError {
-					code = http.StatusInternalServerError
+				if typeCode, ok := errorCodes[customErr.Type]; ok && typeCode > code {
+					code = typeCode
+				}
+				for name, values := range customErr.Headers {
+					for _, value := range values {
+						c.Writer.Header().Add(name, value)
+					}
+				}
+				if len(customErr.Causes) > 0 {
+					for _, cause := range customErr.Causes {
+						errs = append(errs, cause)
+					}
+					continue
 				}
 				errs = append(errs, customErr)
 				continue
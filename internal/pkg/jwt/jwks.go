@@ -0,0 +1,168 @@
+package jwt
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// jwksRefreshInterval limits refetches of a remote key set caused by tokens signed with unknown keys
+	jwksRefreshInterval = time.Minute
+	// jwksMaxAge makes a remote key set refetched even if all tokens use known keys, so revoked keys are dropped
+	jwksMaxAge  = time.Hour
+	jwksTimeout = 5 * time.Second
+)
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// keySet holds RSA keys of a JWKS loaded from a file once or fetched from a URL and refreshed from time to time
+type keySet struct {
+	source string
+	remote bool
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newKeySet(source string) (*keySet, error) {
+	set := &keySet{
+		source: source,
+		remote: strings.HasPrefix(source, "http://") || strings.HasPrefix(source, "https://"),
+		client: &http.Client{Timeout: jwksTimeout},
+	}
+	if err := set.load(); err != nil {
+		return nil, err
+	}
+
+	return set, nil
+}
+
+// key returns the key with the ID, a token without a key ID can be used only with a key set of one key
+func (set *keySet) key(kid string) (*rsa.PublicKey, error) {
+	set.mu.Lock()
+	defer set.mu.Unlock()
+
+	stale := time.Since(set.fetchedAt) > jwksMaxAge
+	key, known := set.lookup(kid)
+	if set.remote && (stale || !known && time.Since(set.fetchedAt) > jwksRefreshInterval) {
+		if err := set.load(); err != nil {
+			// the keys fetched before are still used while the key set can't be refreshed
+			if !known {
+				return nil, fmt.Errorf("%w: %v", ErrKeysUnavailable, err)
+			}
+			return key, nil
+		}
+		key, known = set.lookup(kid)
+	}
+	if !known {
+		return nil, errors.New("token is signed with an unknown key")
+	}
+
+	return key, nil
+}
+
+func (set *keySet) lookup(kid string) (*rsa.PublicKey, bool) {
+	if kid == "" && len(set.keys) == 1 {
+		for _, key := range set.keys {
+			return key, true
+		}
+	}
+	key, ok := set.keys[kid]
+	return key, ok
+}
+
+func (set *keySet) load() error {
+	var (
+		document []byte
+		err      error
+	)
+	if set.remote {
+		document, err = set.fetch()
+	} else {
+		document, err = os.ReadFile(set.source)
+	}
+	if err != nil {
+		return err
+	}
+
+	keys, err := parseKeySet(document)
+	if err != nil {
+		return err
+	}
+	set.keys = keys
+	set.fetchedAt = time.Now()
+
+	return nil
+}
+
+func (set *keySet) fetch() ([]byte, error) {
+	resp, err := set.client.Get(set.source)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS request failed with status %d", resp.StatusCode)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
+
+// parseKeySet keeps the RSA signature keys of the set, other keys are skipped
+func parseKeySet(document []byte) (map[string]*rsa.PublicKey, error) {
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := json.Unmarshal(document, &set); err != nil {
+		return nil, fmt.Errorf("JWKS: %w", err)
+	}
+
+	keys := make(map[string]*rsa.PublicKey)
+	for _, jwk := range set.Keys {
+		if jwk.Kty != "RSA" || jwk.Use != "" && jwk.Use != "sig" || jwk.Alg != "" && jwk.Alg != "RS256" {
+			continue
+		}
+
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %s modulus: %w", jwk.Kid, err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, fmt.Errorf("JWKS key %s exponent: %w", jwk.Kid, err)
+		}
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("JWKS key %s exponent is too large", jwk.Kid)
+		}
+
+		keys[jwk.Kid] = &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("JWKS has no RSA signature keys")
+	}
+
+	return keys, nil
+}
@@ -0,0 +1,68 @@
+package jwt
+
+import (
+	"errors"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"github.com/educ-educ/handlers-service/internal/pkg/http_tools"
+	"github.com/gin-gonic/gin"
+	"strings"
+)
+
+// claimsKey is the key of the gin context the verified claims are stored under
+const claimsKey = "jwt_claims"
+
+const bearerPrefix = "bearer "
+
+// Middleware rejects requests without a valid bearer token and stores the claims of the token in the context
+func Middleware(logger common.Logger, verifier *Verifier) gin.HandlerFunc {
+	return middleware(logger, verifier, true)
+}
+
+// OptionalMiddleware lets requests without a bearer token through anonymously, invalid tokens are still rejected
+func OptionalMiddleware(logger common.Logger, verifier *Verifier) gin.HandlerFunc {
+	return middleware(logger, verifier, false)
+}
+
+func middleware(logger common.Logger, verifier *Verifier, required bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		authorization := c.GetHeader("Authorization")
+		if authorization == "" && !required {
+			c.Next()
+			return
+		}
+
+		hasBearer := len(authorization) > len(bearerPrefix) &&
+			strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix)
+		if !hasBearer {
+			c.Header("WWW-Authenticate", "Bearer")
+			wrappedErr := http_tools.Error{Type: http_tools.UnauthorizedError, Info: "bearer token is required"}
+			_ = c.Error(wrappedErr.AsGinError())
+			c.Abort()
+			return
+		}
+
+		claims, err := verifier.Verify(strings.TrimSpace(authorization[len(bearerPrefix):]))
+		if err != nil {
+			logger.Error(err)
+			wrappedErr := http_tools.Error{Type: http_tools.InvalidTokenError, Info: err.Error()}
+			if errors.Is(err, ErrKeysUnavailable) {
+				wrappedErr.Type = http_tools.UnavailableError
+			} else {
+				c.Header("WWW-Authenticate", `Bearer error="invalid_token"`)
+			}
+			_ = c.Error(wrappedErr.AsGinError())
+			c.Abort()
+			return
+		}
+
+		c.Set(claimsKey, claims)
+		c.Next()
+	}
+}
+
+// ClaimsFrom returns the claims stored by Middleware, they are nil for routes without it
+func ClaimsFrom(c *gin.Context) Claims {
+	claims, _ := c.Get(claimsKey)
+	verified, _ := claims.(Claims)
+	return verified
+}
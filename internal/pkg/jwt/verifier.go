@@ -0,0 +1,200 @@
+package jwt
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// clockSkew is tolerated when the time claims are checked
+const clockSkew = 30 * time.Second
+
+// ErrKeysUnavailable is wrapped by verification errors caused by the key set which can't be fetched,
+// they are not the fault of the token
+var ErrKeysUnavailable = errors.New("signing keys are unavailable")
+
+// Claims are the verified claims of a token, numbers are kept as json.Number
+type Claims map[string]any
+
+type Config struct {
+	// HS256Secret enables HS256 tokens
+	HS256Secret []byte
+	// JWKS is a path or an http(s) URL of a JSON Web Key Set with RSA keys, it enables RS256 tokens
+	JWKS string
+	// Issuer and Audience are checked when set
+	Issuer   string
+	Audience string
+}
+
+// Verifier checks signatures and time claims of HS256 and RS256 tokens. The algorithm of a token must match
+// the configured keys, so an RSA public key can't be used as an HMAC secret and unsigned tokens are refused.
+type Verifier struct {
+	secret   []byte
+	keys     *keySet
+	issuer   string
+	audience string
+}
+
+func NewVerifier(config Config) (*Verifier, error) {
+	if len(config.HS256Secret) == 0 && config.JWKS == "" {
+		return nil, errors.New("either an HS256 secret or a JWKS is required")
+	}
+
+	verifier := &Verifier{
+		secret:   config.HS256Secret,
+		issuer:   config.Issuer,
+		audience: config.Audience,
+	}
+	if config.JWKS != "" {
+		keys, err := newKeySet(config.JWKS)
+		if err != nil {
+			return nil, err
+		}
+		verifier.keys = keys
+	}
+
+	return verifier, nil
+}
+
+type header struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// Verify returns the claims of the token if its signature is valid and it is neither expired nor used too early
+func (verifier *Verifier) Verify(token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, errors.New("token must consist of three parts")
+	}
+
+	var head header
+	if err := decodeSegment(parts[0], &head); err != nil {
+		return nil, fmt.Errorf("token header: %w", err)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("token signature: %w", err)
+	}
+	signed := []byte(parts[0] + "." + parts[1])
+
+	switch head.Alg {
+	case "HS256":
+		if len(verifier.secret) == 0 {
+			return nil, errors.New("HS256 tokens are not accepted")
+		}
+		mac := hmac.New(sha256.New, verifier.secret)
+		mac.Write(signed)
+		if !hmac.Equal(signature, mac.Sum(nil)) {
+			return nil, errors.New("token signature is invalid")
+		}
+	case "RS256":
+		if verifier.keys == nil {
+			return nil, errors.New("RS256 tokens are not accepted")
+		}
+		key, err := verifier.keys.key(head.Kid)
+		if err != nil {
+			return nil, err
+		}
+		digest := sha256.Sum256(signed)
+		if err = rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature); err != nil {
+			return nil, errors.New("token signature is invalid")
+		}
+	default:
+		return nil, fmt.Errorf("token algorithm %q is not supported", head.Alg)
+	}
+
+	var claims Claims
+	if err = decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("token claims: %w", err)
+	}
+	if err = verifier.checkClaims(claims, time.Now()); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
+
+func (verifier *Verifier) checkClaims(claims Claims, now time.Time) error {
+	expiresAt, ok, err := numericDate(claims, "exp")
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return errors.New("token has no expiry")
+	}
+	if now.After(expiresAt.Add(clockSkew)) {
+		return errors.New("token is expired")
+	}
+
+	notBefore, ok, err := numericDate(claims, "nbf")
+	if err != nil {
+		return err
+	}
+	if ok && now.Add(clockSkew).Before(notBefore) {
+		return errors.New("token is not valid yet")
+	}
+
+	if verifier.issuer != "" && claims["iss"] != verifier.issuer {
+		return errors.New("token issuer is not accepted")
+	}
+	if verifier.audience != "" && !hasAudience(claims["aud"], verifier.audience) {
+		return errors.New("token audience is not accepted")
+	}
+
+	return nil
+}
+
+// numericDate reads the time claim, which holds seconds since the epoch
+func numericDate(claims Claims, name string) (time.Time, bool, error) {
+	value, ok := claims[name]
+	if !ok {
+		return time.Time{}, false, nil
+	}
+
+	number, ok := value.(json.Number)
+	if !ok {
+		return time.Time{}, false, fmt.Errorf("token claim %s must be a number", name)
+	}
+	seconds, err := number.Float64()
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("token claim %s must be a number", name)
+	}
+
+	return time.Unix(0, int64(seconds*float64(time.Second))), true, nil
+}
+
+// hasAudience accepts the aud claim either as a single string or as a list of them
+func hasAudience(claim any, audience string) bool {
+	switch aud := claim.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, item := range aud {
+			if item == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func decodeSegment(segment string, target any) error {
+	decoded, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(decoded))
+	decoder.UseNumber()
+	return decoder.Decode(target)
+}
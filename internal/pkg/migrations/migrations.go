@@ -0,0 +1,311 @@
+package migrations
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/educ-educ/handlers-service/internal/pkg/common"
+	"io/fs"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	upSuffix   = ".up.sql"
+	downSuffix = ".down.sql"
+)
+
+// Dialect holds the statements the migrator runs besides the migrations themselves
+type Dialect struct {
+	// Lock and Unlock serialize migrators of concurrent replicas on the same connection, they are skipped when empty
+	Lock   string
+	Unlock string
+	// CreateVersionTable must create the schema_version (version, name, applied_at) table if it doesn't exist
+	CreateVersionTable string
+	// InsertVersion takes the version and the name of an applied migration, DeleteVersion takes the reverted version
+	InsertVersion string
+	DeleteVersion string
+	// BeforeMigration and AfterMigration run around the transaction of every migration, they are skipped when empty
+	BeforeMigration string
+	AfterMigration  string
+}
+
+// Postgres takes a session advisory lock, so replicas started together wait for each other
+var Postgres = Dialect{
+	Lock:   `SELECT pg_advisory_lock(7201443958)`,
+	Unlock: `SELECT pg_advisory_unlock(7201443958)`,
+	CreateVersionTable: `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	InsertVersion: `INSERT INTO schema_version (version, name) VALUES ($1, $2)`,
+	DeleteVersion: `DELETE FROM schema_version WHERE version = $1`,
+}
+
+// SQLite relies on the database file lock, every migration transaction is serialized by SQLite itself.
+// Foreign keys are off during migrations, so a table can be rebuilt without cascading to the tables referencing it,
+// the pragma has no effect inside a transaction.
+var SQLite = Dialect{
+	CreateVersionTable: `CREATE TABLE IF NOT EXISTS schema_version (
+		version INTEGER PRIMARY KEY,
+		name TEXT NOT NULL,
+		applied_at TEXT NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`,
+	InsertVersion:   `INSERT INTO schema_version (version, name) VALUES (?, ?)`,
+	DeleteVersion:   `DELETE FROM schema_version WHERE version = ?`,
+	BeforeMigration: `PRAGMA foreign_keys = OFF`,
+	AfterMigration:  `PRAGMA foreign_keys = ON`,
+}
+
+// Migration is a pair of scripts loaded from <version>_<name>.up.sql and <version>_<name>.down.sql files
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Load reads migrations from the root of fsys ordered by version. Every migration must have an up script,
+// a down script is optional and only needed to revert it.
+func Load(fsys fs.FS) ([]Migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, entry := range entries {
+		fileName := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(fileName, ".sql") {
+			continue
+		}
+
+		var (
+			base string
+			up   bool
+		)
+		switch {
+		case strings.HasSuffix(fileName, upSuffix):
+			base, up = strings.TrimSuffix(fileName, upSuffix), true
+		case strings.HasSuffix(fileName, downSuffix):
+			base = strings.TrimSuffix(fileName, downSuffix)
+		default:
+			return nil, fmt.Errorf("migration %s must end with %s or %s", fileName, upSuffix, downSuffix)
+		}
+
+		versionPart, name, _ := strings.Cut(base, "_")
+		version, err := strconv.Atoi(versionPart)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("migration %s must start with a positive version number", fileName)
+		}
+
+		script, err := fs.ReadFile(fsys, fileName)
+		if err != nil {
+			return nil, err
+		}
+
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: name}
+			byVersion[version] = migration
+		}
+		if migration.Name != name {
+			return nil, fmt.Errorf("migrations %s and %s share version %d", migration.Name, name, version)
+		}
+		if up {
+			migration.Up = string(script)
+		} else {
+			migration.Down = string(script)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" {
+			return nil, fmt.Errorf("migration %d %s has no up script", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+
+	return migrations, nil
+}
+
+// Migrator applies migrations and records them in the schema_version table. Each migration runs in its own
+// transaction, the dialect lock makes concurrent runs wait for each other, so replicas started together
+// apply every migration exactly once.
+type Migrator struct {
+	logger     common.Logger
+	db         *sql.DB
+	dialect    Dialect
+	migrations []Migration
+}
+
+func NewMigrator(logger common.Logger, db *sql.DB, dialect Dialect, fsys fs.FS) (*Migrator, error) {
+	migrations, err := Load(fsys)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Migrator{
+		logger:     logger,
+		db:         db,
+		dialect:    dialect,
+		migrations: migrations,
+	}, nil
+}
+
+// Up applies every migration which is not applied yet
+func (migrator *Migrator) Up(ctx context.Context) error {
+	return migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for _, migration := range migrator.migrations {
+			if applied[migration.Version] {
+				continue
+			}
+
+			migrator.logger.Info("applying migration ", migration.Version, " ", migration.Name)
+			err = migrator.apply(ctx, conn, migration.Up, migrator.dialect.InsertVersion, migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// Down reverts the given number of the latest applied migrations
+func (migrator *Migrator) Down(ctx context.Context, steps int) error {
+	return migrator.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		for i := len(migrator.migrations) - 1; i >= 0 && steps > 0; i-- {
+			migration := migrator.migrations[i]
+			if !applied[migration.Version] {
+				continue
+			}
+			if migration.Down == "" {
+				return fmt.Errorf("migration %d %s can't be reverted, it has no down script",
+					migration.Version, migration.Name)
+			}
+
+			migrator.logger.Info("reverting migration ", migration.Version, " ", migration.Name)
+			err = migrator.apply(ctx, conn, migration.Down, migrator.dialect.DeleteVersion, migration.Version)
+			if err != nil {
+				return fmt.Errorf("migration %d %s: %w", migration.Version, migration.Name, err)
+			}
+			steps--
+		}
+
+		return nil
+	})
+}
+
+// Version returns the latest applied migration version, zero for an empty database
+func (migrator *Migrator) Version(ctx context.Context) (int, error) {
+	version := 0
+	err := migrator.withLock(ctx, func(conn *sql.Conn) error {
+		return conn.QueryRowContext(ctx, `SELECT COALESCE(MAX(version), 0) FROM schema_version`).Scan(&version)
+	})
+	return version, err
+}
+
+// withLock runs fn on a single connection holding the dialect lock, the schema_version table is created if needed
+func (migrator *Migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := migrator.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err := conn.Close(); err != nil {
+			migrator.logger.Error(err)
+		}
+	}()
+
+	if migrator.dialect.Lock != "" {
+		if _, err = conn.ExecContext(ctx, migrator.dialect.Lock); err != nil {
+			return err
+		}
+		defer func() {
+			// the context may be already cancelled, the lock still has to be released
+			if _, err := conn.ExecContext(context.Background(), migrator.dialect.Unlock); err != nil {
+				migrator.logger.Error(err)
+			}
+		}()
+	}
+
+	if _, err = conn.ExecContext(ctx, migrator.dialect.CreateVersionTable); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func appliedVersions(ctx context.Context, conn *sql.Conn) (map[int]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM schema_version`)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		_ = rows.Close()
+	}()
+
+	applied := make(map[int]bool)
+	version := 0
+	for rows.Next() {
+		if err = rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+
+	return applied, rows.Err()
+}
+
+// apply runs the migration script with the dialect statements around it
+func (migrator *Migrator) apply(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...any) error {
+	if migrator.dialect.BeforeMigration != "" {
+		if _, err := conn.ExecContext(ctx, migrator.dialect.BeforeMigration); err != nil {
+			return err
+		}
+	}
+	if migrator.dialect.AfterMigration != "" {
+		defer func() {
+			if _, err := conn.ExecContext(context.Background(), migrator.dialect.AfterMigration); err != nil {
+				migrator.logger.Error(err)
+			}
+		}()
+	}
+
+	return inTx(ctx, conn, script, bookkeeping, args...)
+}
+
+// inTx runs the migration script and the schema_version bookkeeping statement atomically
+func inTx(ctx context.Context, conn *sql.Conn, script, bookkeeping string, args ...any) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, script); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	if _, err = tx.ExecContext(ctx, bookkeeping, args...); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+
+	return tx.Commit()
+}
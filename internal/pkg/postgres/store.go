@@ -1,11 +1,19 @@
 package postgres
 
 import (
+	"context"
 	"database/sql"
 
 	_ "github.com/lib/pq"
 )
 
+// Executor runs queries either directly on the pool or inside a transaction, both *sql.DB and *sql.Tx implement it
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
 func NewPostgresDb(connURL string) (*sql.DB, func(db *sql.DB), error) {
 	db, err := sql.Open("postgres", connURL)
 	if err != nil {
@@ -18,13 +18,15 @@ type Server struct {
 	router *gin.Engine
 }
 
-func NewServer(logger common.Logger, router *gin.Engine, addr string) *Server {
+// NewServer makes a server which lets responses be written for as long as the slowest upstream call is allowed
+// to take
+func NewServer(logger common.Logger, router *gin.Engine, addr string, upstreamTimeout time.Duration) *Server {
 	serv := &Server{
 		logger: logger,
 		router: router,
 	}
 
-	serv.configure(addr)
+	serv.configure(addr, upstreamTimeout)
 
 	return serv
 }
@@ -59,10 +61,10 @@ func (s *Server) Start() error {
 	return nil
 }
 
-func (s *Server) configure(addr string) {
+func (s *Server) configure(addr string, upstreamTimeout time.Duration) {
 	s.Addr = addr
 	s.Handler = s.router
 	s.IdleTimeout = 5 * time.Second
 	s.ReadTimeout = 5 * time.Second
-	s.WriteTimeout = 5 * time.Second
+	s.WriteTimeout = 5*time.Second + upstreamTimeout
 }
@@ -0,0 +1,40 @@
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	_ "modernc.org/sqlite"
+)
+
+const Scheme = "sqlite://"
+
+// NewSQLiteDb opens the database file from a sqlite:// URL, like sqlite:///var/lib/handlers/registry.db
+// for an absolute path or sqlite://registry.db for a path relative to the working directory
+func NewSQLiteDb(connURL string) (*sql.DB, func(db *sql.DB), error) {
+	path := strings.TrimPrefix(connURL, Scheme)
+	if path == connURL || path == "" {
+		return nil, nil, errors.New("sqlite URL must look like sqlite://<path to the database file>")
+	}
+	path, _, _ = strings.Cut(path, "?")
+
+	// foreign keys are off by default in SQLite, cascades of the schema depend on them
+	db, err := sql.Open("sqlite", "file:"+path+
+		"?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, nil, err
+	}
+	// SQLite has a single writer, one connection keeps transactions from failing with "database is locked"
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, nil, err
+	}
+
+	return db, closeSQLiteDb, nil
+}
+
+func closeSQLiteDb(db *sql.DB) {
+	_ = db.Close()
+}